@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/spf13/cobra"
+	"gitlab.ssec.wisc.edu/dbrtn/wispub/internal"
+)
+
+var checkCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Check connectivity and permissions for a broker",
+	Long: `Diagnose problems connecting and publishing to a WIS 2.0 MQTT broker.
+
+Each step is run in order until one fails, and a pass/fail report is printed for each:
+	dns           resolve the broker host
+	tcp           connect to the broker
+	tls           for ssl:// brokers, perform the TLS handshake and report the certificate
+	              chain, expiry and whether it matches the host name
+	mqtt connect  connect with the broker credentials and report the CONNACK reason and
+	              server properties, e.g., maximum QoS and packet size
+	publish       with --publish-topic, publish a test message and report the PUBACK reason
+
+The test message is not a notification message, so --publish-topic should be a sandbox
+topic that no subscribers expect notification messages on.
+`,
+	Example: `
+export WISPUB_BROKER_USER=<username>
+export WISPUB_BROKER_PASSWD=<password>
+
+wispub check \
+	--broker=ssl://<broker host> \
+	--publish-topic=sandbox/wispub
+`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		flags := cmd.Flags()
+		broker, err := flags.GetString("broker")
+		cobra.CheckErr(err)
+		brokerURL, err := url.Parse(broker)
+		if err != nil {
+			return fmt.Errorf("invalid broker URL")
+		}
+		setDefaultPort(brokerURL)
+
+		opts := internal.CheckOptions{Broker: brokerURL}
+		opts.ClientID, err = flags.GetString("client-id")
+		cobra.CheckErr(err)
+		if opts.ClientID == "" {
+			opts.ClientID = "wispub-check-" + uuid.New().String()[:8]
+		}
+		opts.TLSCA, err = flags.GetString("tls-ca")
+		cobra.CheckErr(err)
+		opts.Insecure, err = flags.GetBool("insecure")
+		cobra.CheckErr(err)
+		opts.Topic, err = flags.GetString("publish-topic")
+		cobra.CheckErr(err)
+		opts.Timeout, err = flags.GetDuration("timeout")
+		cobra.CheckErr(err)
+
+		ctx := exitHandlerContext()
+
+		cmd.SilenceUsage = true
+		return doCheckCmd(ctx, opts)
+	},
+}
+
+func init() {
+	flags := checkCmd.Flags()
+	flags.String("broker", "",
+		"MQTT broker URL to check. Can be tcp:// or ssl://. If the port is not included it "+
+			"will default to "+fmt.Sprintf("%v for tcp and %v for ssl.", defaultPort, defaultSSLPort))
+	flags.String("client-id", "", "MQTT client id. Defaults to a random id")
+	flags.String("tls-ca", "", "CA certificate file to trust in addition to the system certificates")
+	flags.Bool("insecure", false, "If using TLS, don't fail if the remote server certificate cannot be verified")
+	flags.String("publish-topic", "", "Topic to publish a test message to. No message is published if not set")
+	flags.Duration("timeout", 10*time.Second, "Timeout for each step")
+
+	cobra.CheckErr(cobra.MarkFlagRequired(flags, "broker"))
+
+	rootCmd.AddCommand(checkCmd)
+}
+
+func doCheckCmd(ctx context.Context, opts internal.CheckOptions) error {
+	fmt.Printf("checking %s\n", opts.Broker.Redacted())
+	steps := internal.CheckBroker(ctx, opts)
+	writeCheckReport(os.Stdout, steps)
+	for _, step := range steps {
+		if !step.OK() {
+			return fmt.Errorf("check failed at %s", step.Name)
+		}
+	}
+	return nil
+}
+
+func writeCheckReport(w io.Writer, steps []*internal.CheckStep) {
+	for _, step := range steps {
+		status := "PASS"
+		if !step.OK() {
+			status = "FAIL"
+		}
+		fmt.Fprintf(w, "[%s] %s (%s)\n", status, step.Name, step.Duration.Round(time.Millisecond))
+		for _, detail := range step.Details {
+			fmt.Fprintf(w, "       %s\n", detail)
+		}
+		if !step.OK() {
+			fmt.Fprintf(w, "       error: %s\n", step.Err)
+		}
+	}
+}
@@ -1,17 +1,18 @@
 package cmd
 
 import (
-	"bytes"
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/url"
 	"os"
 	"strings"
-	"text/template"
+	"time"
 
 	"github.com/eclipse/paho.golang/paho"
+	"github.com/google/uuid"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"gitlab.ssec.wisc.edu/dbrtn/wispub/internal"
 )
 
@@ -38,6 +39,9 @@ wispub data \
 	--datetime=<yyyy-mm-dd>T<hh:mm:ss>Z,<yyyy-mm-dd>T<hh:mm:ss>Z
 	--meta-id=<metadata identifier> 
 
+The input may also be a http(s):// or s3://<bucket>/<key> URL, in which case 
+--download-url defaults to the input URL.
+
 Add the --dryrun flag to print out message information without sending.
 
 More information on topic hierarchy is available here: 
@@ -46,8 +50,6 @@ More information on topic hierarchy is available here:
 	Args: cobra.NoArgs,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		flags := cmd.Flags()
-		verbose, err := flags.GetBool("verbose")
-		cobra.CheckErr(err)
 		dryrun, err := flags.GetBool("dryrun")
 		cobra.CheckErr(err)
 
@@ -60,9 +62,12 @@ More information on topic hierarchy is available here:
 
 		download, err := flags.GetString("download-url")
 		cobra.CheckErr(err)
-		downloadURL, err := url.Parse(download)
-		if err != nil {
-			return fmt.Errorf("invalid download URL")
+		var downloadURL *url.URL
+		if download != "" {
+			downloadURL, err = url.Parse(download)
+			if err != nil {
+				return fmt.Errorf("invalid download URL")
+			}
 		}
 
 		satellite, err := flags.GetString("satellite")
@@ -74,66 +79,526 @@ More information on topic hierarchy is available here:
 		center, err := flags.GetString("center")
 		cobra.CheckErr(err)
 
-		topic, err := flags.GetString("topic")
+		input, err := flags.GetString("input")
+		cobra.CheckErr(err)
+
+		inputCfg := internal.InputConfig{S3: internal.S3ConfigFromEnv()}
+		inputCfg.TrustMetadata, err = flags.GetBool("trust-remote-metadata")
 		cobra.CheckErr(err)
-		topicTmpl, err := template.New("").Parse(topic)
+		if flags.Changed("s3-endpoint") {
+			inputCfg.S3.Endpoint, err = flags.GetString("s3-endpoint")
+			cobra.CheckErr(err)
+		}
+		if flags.Changed("s3-region") {
+			inputCfg.S3.Region, err = flags.GetString("s3-region")
+			cobra.CheckErr(err)
+		}
+		in, err := internal.NewInput(input, inputCfg)
 		if err != nil {
-			return fmt.Errorf("invalid topic template: %w", err)
+			return fmt.Errorf("invalid input: %w", err)
 		}
-		buf := &bytes.Buffer{}
-		err = topicTmpl.Execute(buf, struct {
-			Satellite, Observation, Center string
-		}{satellite, observation, center})
+
+		datetime, err := flags.GetString("datetime")
+		cobra.CheckErr(err)
+		start, end, err := internal.ParseDatetime(datetime)
 		if err != nil {
-			return fmt.Errorf("could not render topic template")
+			return fmt.Errorf("failed to parse timestamps: %w", err)
 		}
-		topic = buf.String()
+		// the product time is the start, or the end of intervals with an open start
+		productTime := time.Now()
+		for _, value := range []string{start, end} {
+			if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+				productTime = t
+				break
+			}
+		}
+		tmplCtx := newTemplateContext(satellite, observation, center, in.Name(), productTime)
 
-		input, err := flags.GetString("input")
+		topic, err := flags.GetString("topic")
+		cobra.CheckErr(err)
+		topic, err = renderTemplate("topic", topic, tmplCtx)
+		if err != nil {
+			return err
+		}
+		tmplCtx.Topic, tmplCtx.Levels = topic, strings.Split(topic, "/")
+
+		dataID, err := flags.GetString("data-id")
+		cobra.CheckErr(err)
+		if dataID != "" {
+			dataID, err = renderTemplate("data id", dataID, tmplCtx)
+			if err != nil {
+				return err
+			}
+			if err := internal.ValidateDataID(dataID); err != nil {
+				return err
+			}
+		}
+		var history *internal.History
+		historyPath, err := flags.GetString("history")
 		cobra.CheckErr(err)
+		if historyPath != "" {
+			history, err = internal.OpenHistory(historyPath)
+			if err != nil {
+				return err
+			}
+		}
+
+		stage, err := newStageOptions(flags, tmplCtx, inputCfg.S3)
+		if err != nil {
+			return err
+		}
+		if stage != nil {
+			if downloadURL != nil {
+				return fmt.Errorf("--download-url cannot be used with --stage-dest")
+			}
+			downloadURL = stage.URL
+		}
+
+		roundTrip, err := newRoundTripOptions(flags, tmplCtx, brokerURL)
+		if err != nil {
+			return err
+		}
+
+		if downloadURL == nil && in.URL() == nil {
+			return fmt.Errorf("--download-url is required for local inputs")
+		}
 
 		mimeType, err := flags.GetString("mime-type")
 		cobra.CheckErr(err)
+		mimeDetect, err := flags.GetString("mime-detect")
+		cobra.CheckErr(err)
+		extractKind, err := flags.GetString("extract")
+		cobra.CheckErr(err)
+		bufrTables, err := flags.GetString("bufr-tables")
+		cobra.CheckErr(err)
+		if bufrTables != "" {
+			if err := internal.LoadBUFRTables(bufrTables); err != nil {
+				return fmt.Errorf("loading bufr tables: %w", err)
+			}
+		}
+		mimeMap, err := flags.GetString("mime-map")
+		cobra.CheckErr(err)
+		if mimeMap != "" {
+			if err := internal.LoadMimeMap(mimeMap); err != nil {
+				return fmt.Errorf("loading mime map: %w", err)
+			}
+		}
+
+		props, err := propertiesFromFlags(flags)
+		if err != nil {
+			return err
+		}
 
 		metaId, err := flags.GetString("meta-id")
 		cobra.CheckErr(err)
 
-		datetime, err := flags.GetString("datetime")
+		insecure, err := flags.GetBool("insecure")
 		cobra.CheckErr(err)
 
-		insecure, err := flags.GetBool("insecure")
+		verify := verifyOptions{}
+		verify.Enabled, err = flags.GetBool("verify-download")
+		cobra.CheckErr(err)
+		verify.Integrity, err = flags.GetBool("verify-checksum")
+		cobra.CheckErr(err)
+		verify.Timeout, err = flags.GetDuration("verify-timeout")
 		cobra.CheckErr(err)
+		if verify.Integrity {
+			verify.Enabled = true
+		}
+
+		geometry, err := geometryFromFlags(flags)
+		if err != nil {
+			return err
+		}
+
+		wigosID, err := flags.GetString("wigos-id")
+		cobra.CheckErr(err)
+		if wigosID != "" {
+			if err := internal.ValidateWigosID(wigosID); err != nil {
+				return err
+			}
+		}
+		var pubTime time.Time
+		pubTimeValue, err := flags.GetString("pubtime")
+		cobra.CheckErr(err)
+		if pubTimeValue != "" {
+			pubTime, err = internal.ParseTimestamp(pubTimeValue)
+			if err != nil {
+				return fmt.Errorf("invalid pubtime: %w", err)
+			}
+		}
+		precisionValue, err := flags.GetString("pubtime-precision")
+		cobra.CheckErr(err)
+		precision, err := internal.ParsePubTimePrecision(precisionValue)
+		if err != nil {
+			return err
+		}
+
+		noCache, err := flags.GetBool("no-cache")
+		cobra.CheckErr(err)
+		license, err := flags.GetString("license")
+		cobra.CheckErr(err)
+		var security *internal.Security
+		securityScheme, err := flags.GetString("security")
+		cobra.CheckErr(err)
+		securityDesc, err := flags.GetString("security-description")
+		cobra.CheckErr(err)
+		if securityScheme != "" {
+			security, err = internal.NewSecurity(securityScheme, securityDesc)
+			if err != nil {
+				return err
+			}
+		}
+
+		var links []internal.Link
+		linkValues, err := flags.GetStringArray("link")
+		cobra.CheckErr(err)
+		for _, value := range linkValues {
+			link, err := internal.ParseLink(value)
+			if err != nil {
+				return err
+			}
+			links = append(links, link)
+		}
+
+		var stations *internal.StationRegistry
+		registry, err := flags.GetString("station-registry")
+		cobra.CheckErr(err)
+		if registry != "" {
+			stations, err = internal.LoadStationRegistry(registry)
+			if err != nil {
+				return err
+			}
+		}
 
 		setDefaultPort(brokerURL)
 
 		ctx := exitHandlerContext()
 
-		doDataCmd(ctx, brokerURL, downloadURL, input, topic, mimeType, metaId, center, datetime, verbose, dryrun, insecure)
-		return nil
+		opts := internal.NotificationOptions{
+			Topic:            topic,
+			DataID:           dataID,
+			DownloadURL:      downloadURL,
+			MimeType:         mimeType,
+			MetaID:           metaId,
+			Start:            start,
+			End:              end,
+			Geometry:         geometry,
+			WigosID:          wigosID,
+			Stations:         stations,
+			Links:            links,
+			NoCache:          noCache,
+			LicenseURL:       license,
+			Security:         security,
+			PubTime:          pubTime,
+			PubTimePrecision: precision,
+		}
+		cmd.SilenceUsage = true
+		return doDataCmd(ctx, brokerURL, in, opts, mimeDetect, extractKind, center, stage, verify, roundTrip, props, history, dryrun, insecure)
 	},
 }
 
+// geometryFromFlags returns the geometry from --geometry, --bbox or --point, or nil if
+// none were provided.
+func geometryFromFlags(flags *pflag.FlagSet) (*internal.Geometry, error) {
+	var geometry *internal.Geometry
+	for _, name := range []string{"geometry", "bbox", "point"} {
+		value, err := flags.GetString(name)
+		cobra.CheckErr(err)
+		if value == "" {
+			continue
+		}
+		if geometry != nil {
+			return nil, fmt.Errorf("only one of --geometry, --bbox or --point may be used")
+		}
+		switch name {
+		case "geometry":
+			geometry, err = internal.ParseGeometry(value)
+		case "bbox":
+			geometry, err = internal.ParseBBox(value)
+		case "point":
+			geometry, err = internal.ParsePoint(value)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid --%s: %w", name, err)
+		}
+	}
+	return geometry, nil
+}
+
+// stageOptions configure staging the input to a download server before publishing
+type stageOptions struct {
+	Dest   string
+	Config internal.StageConfig
+	// Path is the path relative to the staging destination
+	Path string
+	// URL is the download URL of the staged file
+	URL *url.URL
+}
+
+// newStageOptions returns the staging configuration from the command flags, or nil if
+// staging is not enabled.
+func newStageOptions(flags *pflag.FlagSet, tmplCtx templateContext, s3 internal.S3Config) (*stageOptions, error) {
+	dest, err := flags.GetString("stage-dest")
+	cobra.CheckErr(err)
+	if dest == "" {
+		return nil, nil
+	}
+
+	base, err := flags.GetString("stage-base-url")
+	cobra.CheckErr(err)
+	if base == "" {
+		return nil, fmt.Errorf("--stage-base-url is required with --stage-dest")
+	}
+	baseURL, err := url.Parse(base)
+	if err != nil {
+		return nil, fmt.Errorf("invalid stage base URL")
+	}
+
+	relpath, err := flags.GetString("stage-path")
+	cobra.CheckErr(err)
+	relpath, err = renderTemplate("stage path", relpath, tmplCtx)
+	if err != nil {
+		return nil, err
+	}
+	// the URL must be of the path the stagers write to
+	relpath, err = internal.CleanStagePath(relpath)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := internal.StageConfig{
+		S3:       s3,
+		User:     os.Getenv("WISPUB_STAGE_USER"),
+		Password: os.Getenv("WISPUB_STAGE_PASSWD"),
+	}
+	cfg.SSHKey, err = flags.GetString("stage-ssh-key")
+	cobra.CheckErr(err)
+	cfg.KnownHosts, err = flags.GetString("stage-known-hosts")
+	cobra.CheckErr(err)
+
+	return &stageOptions{
+		Dest:   dest,
+		Config: cfg,
+		Path:   relpath,
+		URL:    internal.StagedURL(baseURL, relpath),
+	}, nil
+}
+
+// roundTripOptions configure waiting for the published message to be received back
+type roundTripOptions struct {
+	// Broker is the broker to subscribe to, e.g., a Global Broker
+	Broker *url.URL
+	// Topic is the topic filter to subscribe to
+	Topic   string
+	Timeout time.Duration
+}
+
+// newRoundTripOptions returns the round-trip verification configuration from the command
+// flags, or nil if not enabled.
+func newRoundTripOptions(flags *pflag.FlagSet, tmplCtx templateContext, brokerURL *url.URL) (*roundTripOptions, error) {
+	enabled, err := flags.GetBool("verify-roundtrip")
+	cobra.CheckErr(err)
+	if !enabled {
+		return nil, nil
+	}
+
+	opts := &roundTripOptions{Broker: brokerURL, Topic: tmplCtx.Topic}
+	broker, err := flags.GetString("roundtrip-broker")
+	cobra.CheckErr(err)
+	if broker != "" {
+		opts.Broker, err = url.Parse(broker)
+		if err != nil {
+			return nil, fmt.Errorf("invalid round-trip broker URL")
+		}
+		setDefaultPort(opts.Broker)
+	}
+	topic, err := flags.GetString("roundtrip-topic")
+	cobra.CheckErr(err)
+	if topic != "" {
+		opts.Topic, err = renderTemplate("round-trip topic", topic, tmplCtx)
+		if err != nil {
+			return nil, err
+		}
+	}
+	opts.Timeout, err = flags.GetDuration("roundtrip-timeout")
+	cobra.CheckErr(err)
+	return opts, nil
+}
+
+// propertyOptions are additional message properties
+type propertyOptions struct {
+	Values map[string]any
+	// Force allows Values to overwrite properties defined by the specification
+	Force bool
+}
+
+// propertiesFromFlags returns the additional properties from --data-domain,
+// --properties-file and --property, in order of increasing precedence.
+func propertiesFromFlags(flags *pflag.FlagSet) (propertyOptions, error) {
+	props := propertyOptions{Values: map[string]any{}}
+	var err error
+	props.Force, err = flags.GetBool("force-properties")
+	cobra.CheckErr(err)
+
+	dataDomain, err := flags.GetString("data-domain")
+	cobra.CheckErr(err)
+	if dataDomain != "" {
+		props.Values["dataDomain"] = dataDomain
+	}
+
+	fpath, err := flags.GetString("properties-file")
+	cobra.CheckErr(err)
+	if fpath != "" {
+		values, err := internal.LoadProperties(fpath)
+		if err != nil {
+			return props, err
+		}
+		for k, v := range values {
+			props.Values[k] = v
+		}
+	}
+
+	values, err := flags.GetStringArray("property")
+	cobra.CheckErr(err)
+	for _, value := range values {
+		k, v, err := internal.ParseProperty(value)
+		if err != nil {
+			return props, err
+		}
+		props.Values[k] = v
+	}
+	return props, nil
+}
+
+// verifyOptions configure download URL verification before publishing
+type verifyOptions struct {
+	Enabled   bool
+	Integrity bool
+	Timeout   time.Duration
+}
+
 func init() {
 	flags := dataCmd.Flags()
-	flags.Bool("verbose", false, "Verbose logging")
+	flags.Bool("verbose", false, "Verbose logging. Same as --log-level=debug")
 	flags.Bool("dryrun", false, "Generate and print the message and topic, but don't send")
 
 	flags.String("broker", "",
 		"MQTT broker URL to publish messages to. Can be tcp:// or ssl://. If the port is not included it "+
 			"will default to "+fmt.Sprintf("%v for tcp and %v for ssl.", defaultPort, defaultSSLPort))
-	flags.StringP("input", "i", "", "Path to the file to send")
-	flags.StringP("download-url", "u", "", "Publicly available URL where the data can be downloaded")
+	flags.StringP("input", "i", "",
+		"Path or URL of the file to send. Can be a local path, http(s):// or s3://<bucket>/<key>. Remote "+
+			"inputs are streamed to compute the size and checksum")
+	flags.StringP("download-url", "u", "",
+		"Publicly available URL where the data can be downloaded. Required for local inputs, otherwise "+
+			"defaults to the input URL")
+	flags.Bool("trust-remote-metadata", false,
+		"For remote inputs, use the size and checksum from the server response headers (Repr-Digest, Digest or "+
+			"x-amz-checksum-sha256) when available rather than downloading the content")
+	flags.String("s3-endpoint", "",
+		"Endpoint URL for s3:// inputs, e.g., for a MinIO server. Defaults to AWS_ENDPOINT_URL_S3 or AWS_ENDPOINT_URL, "+
+			"otherwise AWS. Credentials are read from AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	flags.String("s3-region", "", "Region for s3:// inputs. Defaults to AWS_REGION or us-east-1")
 	flags.StringP("topic", "t", "", "Topic (template) to publish the message to. Can include template variables: {{.Satellite}}, {{.Observation}}, {{.Center}}")
+	flags.String("data-id", "",
+		"Data id (template) for properties.data_id. Defaults to the topic without its first 2 levels and the input "+
+			"file name. Can include template variables: {{.Topic}}, {{index .Levels N}}, {{.Filename}}, "+
+			"{{.Satellite}}, {{.Observation}}, {{.Center}}, {{.Year}}, {{.Month}}, {{.Day}}, {{.Hour}}, {{.Minute}}, "+
+			"{{.Jday}}")
+	flags.String("history", "",
+		"Local history file of published notifications, used to warn when a data_id is reused for different content")
+	flags.String("satellite", "", "Satellite name available to templates as {{.Satellite}}")
+	flags.String("observation", "", "Observation type available to templates as {{.Observation}}")
+	flags.StringP("center", "c", "", "WMO center identifier available to templates as {{.Center}}. Also used as the MQTT client id")
 	flags.Bool("insecure", false, "If using TLS, don't verify the remote server certificate")
-	flags.StringP("mime-type", "m", "", "Mime-type for the provided input. If not provided it will be determined by file extension.")
-	flags.StringP("data-domain", "d", "DBNet", "Data domain indicator to add to the message properties.dataDomain")
+	flags.StringP("mime-type", "m", "", "Mime-type for the provided input. If not provided it will be determined by --mime-detect.")
+	flags.String("mime-detect", internal.MimeDetectAuto,
+		"How to determine the mime-type if --mime-type is not provided. One of auto, content or extension. auto uses "+
+			"the file extension, and the file content only if the extension is unknown, content prefers the type "+
+			"determined from the file content, extension only uses the file extension")
+	flags.String("mime-map", "",
+		"JSON file mapping file name patterns to mime-types, e.g., {\".nc.gz\": \"application/gzip\", \"*_ql.png\": \"image/png\"}. "+
+			"Patterns can be an extension, a file name suffix, or a glob matching the whole file name, and take "+
+			"precedence over the built in types")
+	flags.StringP("data-domain", "d", "DBNet",
+		"Data domain indicator to add to the message properties.dataDomain. Use an empty value to omit it")
+	flags.StringArray("property", nil,
+		"Additional message property as <key>=<value>. The value is decoded as JSON if valid, e.g., 1, true or "+
+			"{\"a\": 1}, otherwise it is a string. May be repeated, and takes precedence over --properties-file")
+	flags.String("properties-file", "", "JSON file containing an object of additional message properties")
+	flags.Bool("force-properties", false,
+		"Allow --property and --properties-file to overwrite properties defined by the notification specification")
 	flags.StringP("datetime", "D", "",
-		"Time and date of the data as either a single timestamp or as a comma separated start and end. The format for "+
-			"the timestamp(s) is RFC3339, e.g., <yyyy-mm-dd>T<hh:mm:ss>Z")
+		"Time and date of the data as either a single timestamp, an ISO 8601 interval of <start>/<end>, "+
+			"<start>/<duration> or <duration>/<end>, or a comma separated start and end. Timestamps are RFC3339, e.g., "+
+			"<yyyy-mm-dd>T<hh:mm:ss>Z, a date, or Unix epoch seconds prefixed with @, e.g., @1704164645, and are "+
+			"converted to UTC. Plain numbers are basic format dates, e.g., 20240102, not epoch seconds. Open-ended "+
+			"intervals with .. are not supported, give a <start>/<duration> instead")
 	flags.StringP("meta-id", "e", "", "Previously registered metadata identifier for data product")
+	flags.StringArray("link", nil,
+		"Additional link as comma separated <key>=<value> pairs, e.g., href=https://mirror/file.nc,rel=via. Keys are "+
+			"href, rel (via, alternate, preview, etc.; default alternate), type (default from the href file name), "+
+			"length, and integrity (<method>:<base64 value>). May be repeated. The download URL is always the "+
+			"canonical link")
+	flags.Bool("no-cache", false, "Set properties.cache to false so WIS2 Global Caches do not cache the data")
+	flags.String("license", "", "URL of the data license, added as a license link. Required for data/recommended topics")
+	flags.String("security", "",
+		"Access control of the download URL for recommended data, added as the link security. One of basic, bearer, "+
+			"digest, apiKey, oauth2, openIdConnect or mutualTLS")
+	flags.String("security-description", "",
+		"Description of how to get access to the download URL, e.g., who to contact, used with --security")
+	flags.String("pubtime", "",
+		"Publication time to use instead of the current time, e.g., when replaying or back filling notifications")
+	flags.String("pubtime-precision", "ms", "Precision of the publication time. One of s, ms, us or ns")
+	flags.String("geometry", "",
+		"GeoJSON Point, Polygon or MultiPolygon geometry of the data, either inline or the path to a GeoJSON file. "+
+			"A Feature may be used in which case its geometry is used. Polygons must follow the right-hand rule")
+	flags.String("bbox", "", "Bounding box of the data as <west>,<south>,<east>,<north> in degrees. Alternative to --geometry")
+	flags.String("point", "", "Location of the data as <lon>,<lat>[,<z>]. Alternative to --geometry")
+	flags.String("wigos-id", "",
+		"WIGOS station identifier of the data, e.g., 0-20000-0-12345, added as properties.wigos_station_identifier")
+	flags.String("station-registry", "",
+		"CSV or JSON station list, e.g., an OSCAR/Surface export, used to set a point geometry from the location of "+
+			"the --wigos-id station, or the station extracted from the input, when a geometry is not provided")
+	flags.String("extract", internal.ExtractNone,
+		"Extract the geometry and datetimes from the input content when not provided by --geometry, --bbox, --point "+
+			"or --datetime. One of none, auto, netcdf, bufr or grib2. netcdf uses the ACDD geospatial_* and "+
+			"time_coverage_* global attributes of NetCDF and HDF5 files, bufr uses the station identifier, location "+
+			"and observation time of each subset of BUFR messages, grib2 uses the reference time, forecast time and "+
+			"grid of each GRIB2 field, and auto chooses the extractor by mime-type. With auto, GRIB1 files are skipped and "+
+			"inputs that cannot be extracted from are published without the extracted values")
+	flags.String("bufr-tables", "",
+		"Directory containing WMO BUFR master tables, BUFRCREX_TableB_en.csv and BUFR_TableD_en.csv, used in addition "+
+			"to the built in tables when extracting from BUFR")
+	flags.Bool("verify-download", false,
+		"Before publishing, verify the download URL is reachable and serves content with the same length as the input")
+	flags.Bool("verify-checksum", false,
+		"Before publishing, also download the content from the download URL and verify its checksum. Implies --verify-download")
+	flags.Duration("verify-timeout", 30*time.Second, "Timeout for download URL verification")
+	flags.Bool("verify-roundtrip", false,
+		"Subscribe before publishing and wait for the published message to be received back, reporting the latency. "+
+			"It is an error if the message is not received within --roundtrip-timeout")
+	flags.String("roundtrip-broker", "",
+		"Broker to subscribe to for --verify-roundtrip, e.g., a Global Broker. Credentials may be included in the URL, "+
+			"otherwise WISPUB_BROKER_USER and WISPUB_BROKER_PASSWD are used. Defaults to --broker")
+	flags.String("roundtrip-topic", "",
+		"Topic filter (template) to subscribe to for --verify-roundtrip, e.g., when a Global Broker mirrors the message "+
+			"on a different topic. Can include the same template variables as --data-id. Defaults to the publish topic")
+	flags.Duration("roundtrip-timeout", 30*time.Second, "How long to wait for the message with --verify-roundtrip")
+	flags.String("stage-dest", "",
+		"Copy the input to this destination before publishing. Can be a local directory, sftp://[user@]host/path, "+
+			"webdav(s)://host/path or s3://<bucket>/<prefix>. WebDAV and SFTP credentials are read from "+
+			"WISPUB_STAGE_USER and WISPUB_STAGE_PASSWD")
+	flags.String("stage-base-url", "",
+		"Public base URL corresponding to --stage-dest, used with --stage-path to generate the download URL")
+	flags.String("stage-path", "{{.Filename}}",
+		"Path (template) relative to --stage-dest to copy the input to. Can include template variables: "+
+			"{{.Filename}}, {{.Satellite}}, {{.Observation}}, {{.Center}}, {{.Year}}, {{.Month}}, {{.Day}}, "+
+			"{{.Hour}}, {{.Minute}}, {{.Jday}}")
+	flags.String("stage-ssh-key", "", "Private key file for sftp staging destinations")
+	flags.String("stage-known-hosts", "", "Known hosts file for sftp staging destinations. Defaults to ~/.ssh/known_hosts")
 
 	cobra.CheckErr(cobra.MarkFlagRequired(flags, "broker"))
-	cobra.CheckErr(cobra.MarkFlagRequired(flags, "download-url"))
 	cobra.CheckErr(cobra.MarkFlagRequired(flags, "topic"))
 	cobra.CheckErr(cobra.MarkFlagRequired(flags, "input"))
 	cobra.CheckErr(cobra.MarkFlagRequired(flags, "meta-id"))
@@ -143,40 +608,93 @@ func init() {
 
 func doDataCmd(
 	ctx context.Context,
-	brokerURL, downloadURL *url.URL,
-	input, topic, mimeType, metaId, center, datetime string,
-	verbose, dryrun, insecure bool,
-) {
-	if verbose {
-		log.Printf("connecting to %+s", brokerURL)
+	brokerURL *url.URL,
+	input internal.Input,
+	opts internal.NotificationOptions,
+	mimeDetect, extractKind, center string,
+	stage *stageOptions,
+	verify verifyOptions,
+	roundTrip *roundTripOptions,
+	props propertyOptions,
+	history *internal.History,
+	dryrun, insecure bool,
+) error {
+	logger := slog.With("topic", opts.Topic)
+
+	if opts.MimeType == "" {
+		var err error
+		opts.MimeType, err = internal.DetectMimeType(ctx, input, mimeDetect)
+		if err != nil {
+			return fmt.Errorf("failed to determine mime-type: %w", err)
+		}
 	}
 
-	start, end, err := parseDatetime(datetime)
+	extractor, err := internal.NewExtractor(extractKind, opts.MimeType)
 	if err != nil {
-		log.Fatalf("failed to parse timestamps: %s", err)
+		return err
 	}
+	opts.Extractor = extractor
 
-	wisMsg, err := internal.NewNotificationMessage(input, topic, downloadURL, mimeType, metaId, start, end)
+	wisMsg, err := internal.NewNotificationMessage(ctx, input, opts)
 	if err != nil {
-		log.Fatalf("failed to construct message from input: %s", err)
+		return fmt.Errorf("failed to construct message from input: %w", err)
 	}
+	logger = logger.With("data_id", wisMsg.Properties.DataID, "message_id", wisMsg.ID)
 
-	var properties map[string]any
-	body, err := internal.EncodeMessage(wisMsg, properties)
+	if history != nil {
+		if prev, ok := history.Conflict(wisMsg.Properties.DataID, wisMsg.Properties.Integrity); ok {
+			logger.Warn("data_id was published before with different content", "pubtime", prev.PubTime)
+		}
+	}
+
+	if stage != nil {
+		if dryrun {
+			logger.Info("dryrun, not staging input", "input", input.Name(), "path", stage.Path)
+		} else {
+			logger.Debug("staging input", "input", input.Name(), "path", stage.Path)
+			stager, err := internal.NewStager(stage.Dest, stage.Config)
+			if err != nil {
+				return fmt.Errorf("failed to create stager: %w", err)
+			}
+			info := &internal.InputInfo{Size: wisMsg.Links[0].Length, Integrity: wisMsg.Properties.Integrity}
+			err = internal.StageInput(ctx, stager, input, info, stage.Path)
+			stager.Close()
+			if err != nil {
+				return fmt.Errorf("staging failed: %w", err)
+			}
+		}
+	}
+
+	if verify.Enabled && stage != nil && dryrun {
+		logger.Info("dryrun, not verifying download url of unstaged input", "url", wisMsg.Links[0].Href)
+	} else if verify.Enabled {
+		link := wisMsg.Links[0]
+		var integrity *internal.Integrity
+		if verify.Integrity {
+			integrity = &wisMsg.Properties.Integrity
+		}
+		logger.Debug("verifying download url", "url", link.Href)
+		if _, err := internal.VerifyDownload(ctx, nil, link.Href, link.Length, integrity, verify.Timeout); err != nil {
+			return err
+		}
+	}
+
+	body, err := internal.EncodeMessage(wisMsg, props.Values, props.Force)
 	if err != nil {
-		log.Fatalf("failed to encode message as json: %s", err)
+		return fmt.Errorf("failed to encode message as json: %w", err)
 	}
 
 	if dryrun {
-		os.Stderr.WriteString(topic + "\n")
+		os.Stderr.WriteString(opts.Topic + "\n")
 		os.Stdout.Write(body)
 		os.Stdout.WriteString("\n")
-		return
+		return nil
 	}
 
+	logger.Debug("connecting", "broker", brokerURL.Redacted())
 	client, err := internal.NewClient(ctx, brokerURL, strings.ToLower(center), "", insecure)
 	if err != nil {
-		log.Fatalf("failed to create broker: %s", err)
+		return fmt.Errorf("failed to create broker: %w", err)
 	}
 	defer func() {
 		if client == nil {
@@ -186,27 +704,61 @@ func doDataCmd(
 			ReasonCode: 0,
 		})
 		if err != nil {
-			log.Printf("unclean disconnect: %s", err)
+			logger.Warn("unclean disconnect", "error", err)
 		}
 	}()
 
-	log.Printf("publishing message to topic %s", topic)
+	var rt *internal.RoundTrip
+	if roundTrip != nil {
+		logger.Debug("subscribing for round-trip verification", "broker", roundTrip.Broker.Redacted(), "filter", roundTrip.Topic)
+		rt = internal.NewRoundTrip(wisMsg.ID)
+		clientID := strings.ToLower(center) + "-roundtrip-" + uuid.New().String()[:8]
+		if err := rt.Subscribe(ctx, roundTrip.Broker, clientID, "", insecure, roundTrip.Topic); err != nil {
+			return fmt.Errorf("round-trip subscribe failed: %w", err)
+		}
+		defer func() {
+			if err := rt.Close(); err != nil {
+				logger.Warn("unclean round-trip disconnect", "error", err)
+			}
+		}()
+	}
+
+	logger.Info("publishing message", "broker", brokerURL.Redacted())
 	msg := &paho.Publish{
 		QoS:   1,
-		Topic: topic,
+		Topic: opts.Topic,
 		Properties: &paho.PublishProperties{
 			ContentType: "application/json",
 		},
 		Payload: body,
 	}
-	if verbose {
-		log.Printf("publishing %s", string(body))
-	}
+	logger.Debug("publishing", "message", string(body))
+	published := time.Now()
 	zult, err := client.Publish(ctx, msg)
 	if err != nil {
-		log.Fatalf("publishing failed: %s", err)
+		return fmt.Errorf("publishing failed: %w", err)
 	}
 	if zult.ReasonCode != 0 {
-		log.Printf("unexpected publish response [code=%v]: %v", zult.ReasonCode, internal.PubReason(zult.ReasonCode))
+		logger.Warn("unexpected publish response", "reason_code", zult.ReasonCode, "reason", internal.PubReason(zult.ReasonCode))
+	}
+
+	if history != nil {
+		rec := internal.HistoryRecord{
+			DataID:    wisMsg.Properties.DataID,
+			PubTime:   wisMsg.Properties.PubTime,
+			Integrity: wisMsg.Properties.Integrity,
+		}
+		if err := history.Add(rec); err != nil {
+			logger.Warn("failed to update history", "error", err)
+		}
+	}
+
+	if rt != nil {
+		latency, err := rt.Wait(ctx, published, roundTrip.Timeout)
+		if err != nil {
+			return fmt.Errorf("round-trip verification failed: %w", err)
+		}
+		logger.Info("round-trip verified", "filter", roundTrip.Topic, "latency", latency)
 	}
+	return nil
 }
@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+// newLogger returns a logger writing to w at level, one of debug, info, warn or error,
+// in format, one of text or json.
+func newLogger(w io.Writer, level, format string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid --log-level %q, expected debug, info, warn or error", level)
+	}
+	opts := &slog.HandlerOptions{Level: lvl}
+	switch strings.ToLower(format) {
+	case logFormatText:
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case logFormatJSON:
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	}
+	return nil, fmt.Errorf("invalid --log-format %q, expected %s or %s", format, logFormatText, logFormatJSON)
+}
+
+// setupLogging sets the default logger from the --log-level and --log-format flags. The
+// --verbose flag of commands that have it is the same as --log-level=debug.
+func setupLogging(cmd *cobra.Command) error {
+	flags := cmd.Flags()
+	level, err := flags.GetString("log-level")
+	cobra.CheckErr(err)
+	format, err := flags.GetString("log-format")
+	cobra.CheckErr(err)
+	if verbose := flags.Lookup("verbose"); verbose != nil && verbose.Value.String() == "true" && !flags.Changed("log-level") {
+		level = "debug"
+	}
+	logger, err := newLogger(cmd.ErrOrStderr(), level, format)
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(logger)
+	return nil
+}
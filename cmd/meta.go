@@ -4,7 +4,7 @@ import (
 	"bytes"
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/url"
 	"os"
 	"strings"
@@ -42,8 +42,6 @@ More information on topic hierarchy is available here:
 	Args: cobra.NoArgs,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		flags := cmd.Flags()
-		verbose, err := flags.GetBool("verbose")
-		cobra.CheckErr(err)
 		dryrun, err := flags.GetBool("dryrun")
 		cobra.CheckErr(err)
 
@@ -85,14 +83,14 @@ More information on topic hierarchy is available here:
 
 		ctx := exitHandlerContext()
 
-		doMetaCmd(ctx, brokerURL, input, topic, center, verbose, dryrun, insecure)
-		return nil
+		cmd.SilenceUsage = true
+		return doMetaCmd(ctx, brokerURL, input, topic, center, dryrun, insecure)
 	},
 }
 
 func init() {
 	flags := metaCmd.Flags()
-	flags.Bool("verbose", false, "Verbose logging")
+	flags.Bool("verbose", false, "Verbose logging. Same as --log-level=debug")
 	flags.Bool("dryrun", false, "Generate and print the message and topic, but don't send")
 
 	flags.String("broker", "",
@@ -116,31 +114,26 @@ func doMetaCmd(
 	ctx context.Context,
 	brokerURL *url.URL,
 	input, topic, center string,
-	verbose, dryrun, insecure bool,
-) {
-	if verbose {
-		log.Printf("connecting to %+s", brokerURL)
-	}
+	dryrun, insecure bool,
+) error {
+	logger := slog.With("topic", topic)
 
 	body, err := os.ReadFile(input)
 	if err != nil {
-		log.Fatalf("failed to read input file: %s", err)
-	}
-
-	if err != nil {
-		log.Fatalf("failed to construct message from input: %s", err)
+		return fmt.Errorf("failed to read input file: %w", err)
 	}
 
 	if dryrun {
 		os.Stderr.WriteString(topic + "\n")
 		os.Stdout.Write(body)
 		os.Stdout.WriteString("\n")
-		return
+		return nil
 	}
 
+	logger.Debug("connecting", "broker", brokerURL.Redacted())
 	client, err := internal.NewClient(ctx, brokerURL, strings.ToLower(center), "", insecure)
 	if err != nil {
-		log.Fatalf("failed to create broker: %s", err)
+		return fmt.Errorf("failed to create broker: %w", err)
 	}
 	defer func() {
 		if client == nil {
@@ -150,11 +143,11 @@ func doMetaCmd(
 			ReasonCode: 0,
 		})
 		if err != nil {
-			log.Printf("unclean disconnect: %s", err)
+			logger.Warn("unclean disconnect", "error", err)
 		}
 	}()
 
-	log.Printf("publishing message to topic %s", topic)
+	logger.Info("publishing message", "broker", brokerURL.Redacted())
 	msg := &paho.Publish{
 		QoS:   1,
 		Topic: topic,
@@ -163,14 +156,13 @@ func doMetaCmd(
 		},
 		Payload: body,
 	}
-	if verbose {
-		log.Printf("publishing %s", string(body))
-	}
+	logger.Debug("publishing", "message", string(body))
 	zult, err := client.Publish(ctx, msg)
 	if err != nil {
-		log.Fatalf("publishing failed: %s", err)
+		return fmt.Errorf("publishing failed: %w", err)
 	}
 	if zult.ReasonCode != 0 {
-		log.Printf("unexpected publish response [code=%v]: %v", zult.ReasonCode, internal.PubReason(zult.ReasonCode))
+		logger.Warn("unexpected publish response", "reason_code", zult.ReasonCode, "reason", internal.PubReason(zult.ReasonCode))
 	}
+	return nil
 }
@@ -0,0 +1,322 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/eclipse/paho.golang/paho"
+	"github.com/google/uuid"
+	"github.com/spf13/cobra"
+	"gitlab.ssec.wisc.edu/dbrtn/wispub/internal"
+)
+
+var publishRawCmd = &cobra.Command{
+	Use:     "publish-raw [flags] [FILE|DIR|-]...",
+	Aliases: []string{"raw"},
+	Short:   "Publish pre-built notification messages",
+	Long: `Publish notification messages generated by other systems to a WIS 2.0 MQTT broker.
+
+Messages are read from files, the .json and .jsonl files in directories, or stdin if no
+files are given or a FILE is -. Each may contain a single message or multiple messages,
+e.g., one per line (JSON lines). Messages are published as they are read, so stdin can be
+a continuous stream of messages.
+
+Messages are validated against the WIS2 Notification Message specification and the data
+policy of --topic before publishing, and invalid messages are not published. The id and
+pubtime can be replaced with --new-id and --new-pubtime, e.g., when republishing. The
+command exits with an error if any message could not be published.
+`,
+	Example: `
+export WISPUB_BROKER_USER=<username>
+export WISPUB_BROKER_PASSWD=<password>
+
+wispub publish-raw \
+	--broker=ssl://<broker host> \
+	--topic=origin/a/wis2/<centre-id>/data/core/weather \
+	message.json
+
+generate-messages | wispub publish-raw \
+	--broker=ssl://<broker host> \
+	--topic=origin/a/wis2/<centre-id>/data/core/weather \
+	--new-id --new-pubtime
+
+Add the --dryrun flag to print out the messages without sending.
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		flags := cmd.Flags()
+		dryrun, err := flags.GetBool("dryrun")
+		cobra.CheckErr(err)
+
+		broker, err := flags.GetString("broker")
+		cobra.CheckErr(err)
+		brokerURL, err := url.Parse(broker)
+		if err != nil {
+			return fmt.Errorf("invalid broker URL")
+		}
+		clientID, err := flags.GetString("client-id")
+		cobra.CheckErr(err)
+		if clientID == "" {
+			clientID = "wispub-" + uuid.New().String()[:8]
+		}
+		insecure, err := flags.GetBool("insecure")
+		cobra.CheckErr(err)
+
+		opts := rawOptions{}
+		opts.Topic, err = flags.GetString("topic")
+		cobra.CheckErr(err)
+		if err := internal.ValidateTopic(opts.Topic); err != nil {
+			return err
+		}
+		opts.Validate, err = flags.GetBool("validate")
+		cobra.CheckErr(err)
+		opts.NewID, err = flags.GetBool("new-id")
+		cobra.CheckErr(err)
+		opts.NewPubTime, err = flags.GetBool("new-pubtime")
+		cobra.CheckErr(err)
+		precisionValue, err := flags.GetString("pubtime-precision")
+		cobra.CheckErr(err)
+		opts.PubTimePrecision, err = internal.ParsePubTimePrecision(precisionValue)
+		if err != nil {
+			return err
+		}
+
+		sources, err := rawSources(args)
+		if err != nil {
+			return err
+		}
+
+		setDefaultPort(brokerURL)
+
+		ctx := exitHandlerContext()
+
+		cmd.SilenceUsage = true
+		return doPublishRawCmd(ctx, brokerURL, clientID, sources, opts, dryrun, insecure)
+	},
+}
+
+// rawOptions configure how pre-built messages are published
+type rawOptions struct {
+	Topic            string
+	Validate         bool
+	NewID            bool
+	NewPubTime       bool
+	PubTimePrecision time.Duration
+}
+
+func init() {
+	flags := publishRawCmd.Flags()
+	flags.Bool("verbose", false, "Verbose logging. Same as --log-level=debug")
+	flags.Bool("dryrun", false, "Print the messages that would be published, but don't send")
+
+	flags.String("broker", "",
+		"MQTT broker URL to publish messages to. Can be tcp:// or ssl://. If the port is not included it "+
+			"will default to "+fmt.Sprintf("%v for tcp and %v for ssl.", defaultPort, defaultSSLPort))
+	flags.StringP("topic", "t", "", "Topic to publish the messages to")
+	flags.String("client-id", "", "MQTT client id. Defaults to a random id")
+	flags.Bool("insecure", false, "If using TLS, don't verify the remote server certificate")
+	flags.Bool("validate", true, "Validate messages before publishing. Use --validate=false to publish messages as-is")
+	flags.Bool("new-id", false, "Replace the id of each message with a new UUID")
+	flags.Bool("new-pubtime", false, "Replace properties.pubtime of each message with the current time")
+	flags.String("pubtime-precision", "ms", "Fractional seconds precision of --new-pubtime. One of s, ms, us or ns")
+
+	cobra.CheckErr(cobra.MarkFlagRequired(flags, "broker"))
+	cobra.CheckErr(cobra.MarkFlagRequired(flags, "topic"))
+
+	rootCmd.AddCommand(publishRawCmd)
+}
+
+// rawSources returns the files to read messages from, expanding directories to the
+// .json and .jsonl files they contain. - is stdin, and is the only source if there are
+// no args.
+func rawSources(args []string) ([]string, error) {
+	if len(args) == 0 {
+		return []string{"-"}, nil
+	}
+	sources := []string{}
+	for _, arg := range args {
+		if arg == "-" {
+			sources = append(sources, arg)
+			continue
+		}
+		fi, err := os.Stat(arg)
+		if err != nil {
+			return nil, err
+		}
+		if !fi.IsDir() {
+			sources = append(sources, arg)
+			continue
+		}
+		entries, err := os.ReadDir(arg)
+		if err != nil {
+			return nil, err
+		}
+		names := []string{}
+		for _, e := range entries {
+			ext := strings.ToLower(filepath.Ext(e.Name()))
+			if !e.IsDir() && (ext == ".json" || ext == ".jsonl") {
+				names = append(names, filepath.Join(arg, e.Name()))
+			}
+		}
+		sort.Strings(names)
+		sources = append(sources, names...)
+	}
+	return sources, nil
+}
+
+func doPublishRawCmd(
+	ctx context.Context,
+	brokerURL *url.URL,
+	clientID string,
+	sources []string,
+	opts rawOptions,
+	dryrun, insecure bool,
+) error {
+	var client *paho.Client
+	if !dryrun {
+		slog.Debug("connecting", "broker", brokerURL.Redacted())
+		var err error
+		client, err = internal.NewClient(ctx, brokerURL, clientID, "", insecure)
+		if err != nil {
+			return fmt.Errorf("failed to create broker: %w", err)
+		}
+		defer func() {
+			if err := client.Disconnect(&paho.Disconnect{ReasonCode: 0}); err != nil {
+				slog.Warn("unclean disconnect", "error", err)
+			}
+		}()
+	}
+
+	published, failed := 0, 0
+	for _, source := range sources {
+		err := readRawMessages(source, func(label string, payload []byte) {
+			if err := publishRaw(ctx, client, payload, opts); err != nil {
+				failed++
+				slog.Error("message not published", "source", label, "topic", opts.Topic, "error", err)
+				return
+			}
+			published++
+		})
+		if err != nil {
+			failed++
+			slog.Error("reading messages failed", "source", source, "error", err)
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	if dryrun {
+		slog.Info("dryrun, messages would be published", "topic", opts.Topic, "count", published)
+	} else {
+		slog.Info("published messages", "topic", opts.Topic, "count", published)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d messages could not be published", failed)
+	}
+	return nil
+}
+
+// readRawMessages calls fn with each JSON value read from source, labelled with the
+// source and its index. Reading stops at the first value that is not valid JSON.
+func readRawMessages(source string, fn func(label string, payload []byte)) error {
+	var r io.Reader = os.Stdin
+	if source != "-" {
+		f, err := os.Open(source)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	dec := json.NewDecoder(r)
+	for i := 1; ; i++ {
+		var raw json.RawMessage
+		err := dec.Decode(&raw)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("reading message %d: %w", i, err)
+		}
+		fn(fmt.Sprintf("%s[%d]", source, i), raw)
+	}
+}
+
+func publishRaw(ctx context.Context, client *paho.Client, payload []byte, opts rawOptions) error {
+	var id, pubTime string
+	if opts.NewID {
+		id = uuid.New().String()
+	}
+	if opts.NewPubTime {
+		pubTime = internal.FormatPubTime(time.Now(), opts.PubTimePrecision)
+	}
+	if id != "" || pubTime != "" {
+		var err error
+		payload, err = internal.RewriteMessage(payload, id, pubTime)
+		if err != nil {
+			return err
+		}
+	}
+
+	if opts.Validate {
+		if err := internal.ValidateNotification(payload); err != nil {
+			return err
+		}
+		msg, err := internal.DecodeNotification(payload)
+		if err != nil {
+			return err
+		}
+		problems, warnings := internal.CheckNotification(ctx, msg, internal.NotificationChecks{Topic: opts.Topic})
+		if len(problems) > 0 {
+			return fmt.Errorf("invalid notification: %s", strings.Join(problems, "; "))
+		}
+		for _, warning := range warnings {
+			slog.Warn(warning, "topic", opts.Topic, "data_id", msg.Properties.DataID, "message_id", msg.ID)
+		}
+	}
+
+	if client == nil {
+		os.Stderr.WriteString(opts.Topic + "\n")
+		os.Stdout.Write(payload)
+		os.Stdout.WriteString("\n")
+		return nil
+	}
+
+	logger := slog.With("topic", opts.Topic)
+	var ids struct {
+		ID         string `json:"id"`
+		Properties struct {
+			DataID string `json:"data_id"`
+		} `json:"properties"`
+	}
+	if json.Unmarshal(payload, &ids) == nil {
+		logger = logger.With("data_id", ids.Properties.DataID, "message_id", ids.ID)
+	}
+	logger.Debug("publishing", "message", string(payload))
+	zult, err := client.Publish(ctx, &paho.Publish{
+		QoS:   1,
+		Topic: opts.Topic,
+		Properties: &paho.PublishProperties{
+			ContentType: "application/json",
+		},
+		Payload: payload,
+	})
+	if err != nil {
+		return fmt.Errorf("publishing failed: %w", err)
+	}
+	if zult.ReasonCode != 0 {
+		logger.Warn("unexpected publish response", "reason_code", zult.ReasonCode, "reason", internal.PubReason(zult.ReasonCode))
+	}
+	return nil
+}
@@ -14,6 +14,17 @@ Project: https://github.com/bmflynn/wispub
 `,
 	Args:    cobra.NoArgs,
 	Version: "",
+	// errors are logged by the caller of Execute
+	SilenceErrors: true,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return setupLogging(cmd)
+	},
+}
+
+func init() {
+	flags := rootCmd.PersistentFlags()
+	flags.String("log-level", "info", "Log level. One of debug, info, warn or error")
+	flags.String("log-format", logFormatText, "Log format. One of text or json")
 }
 
 func Execute(version string) error {
@@ -0,0 +1,236 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/spf13/cobra"
+	"gitlab.ssec.wisc.edu/dbrtn/wispub/internal"
+)
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Run an HTTP API for publishing notification messages",
+	Long: `Run a local HTTP API so other services can publish notification messages without
+running wispub for each one. All messages are published over a single broker connection,
+which is re-made if it is lost.
+
+Endpoints:
+	GET  /healthz                 the server is running
+	GET  /readyz                  the server is connected to the broker
+	POST /v1/notifications        publish a notification
+	GET  /v1/notifications        recent publication statuses
+	GET  /v1/notifications/{id}   the status of a publication by message id
+	GET  /v1/history?data_id=...  the --history record of a data_id
+	GET  /metrics                 with --metrics, Prometheus metrics
+
+The /v1 endpoints require the token in WISPUB_API_TOKEN as a bearer token, i.e., an
+"Authorization: Bearer <token>" header.
+
+A publish request is a JSON object with the topic and either a complete notification
+message, which is validated before publishing, or the input to generate a notification
+for, like the data command:
+	{"topic": "...", "message": {...}}
+	{"topic": "...", "input": "/data/granule.nc", "download_url": "https://...",
+	 "metadata_id": "...", "datetime": "...", "data_id": "...", "mime_type": "...",
+	 "wigos_station_identifier": "...", "geometry": {...}, "no_cache": false,
+	 "links": [...], "properties": {...}}
+
+Local inputs must be in a directory given by --input-dir, and are refused if there are
+none. Symlinks are resolved, so they cannot point outside the directories.
+
+The metrics include messages published, failures by PUBACK reason code, publish latency,
+messages waiting for the connection or PUBACK, reconnects and checksum throughput, e.g.,
+alert on time() - wispub_last_published_timestamp_seconds to detect a stalled feed.
+`,
+	Example: `
+export WISPUB_BROKER_USER=<username>
+export WISPUB_BROKER_PASSWD=<password>
+export WISPUB_API_TOKEN=<token>
+
+wispub serve \
+	--broker=ssl://<broker host> \
+	--client-id=<centre-id> \
+	--input-dir=/data
+
+curl -H "Authorization: Bearer $WISPUB_API_TOKEN" http://localhost:8080/v1/notifications \
+	-d '{"topic": "origin/a/wis2/<centre-id>/data/core/weather", "input": "/data/granule.nc", ...}'
+`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		flags := cmd.Flags()
+		metrics, err := flags.GetBool("metrics")
+		cobra.CheckErr(err)
+		listen, err := flags.GetString("listen")
+		cobra.CheckErr(err)
+
+		broker, err := flags.GetString("broker")
+		cobra.CheckErr(err)
+		brokerURL, err := url.Parse(broker)
+		if err != nil {
+			return fmt.Errorf("invalid broker URL")
+		}
+		clientID, err := flags.GetString("client-id")
+		cobra.CheckErr(err)
+		if clientID == "" {
+			clientID = "wispub-serve-" + uuid.New().String()[:8]
+		}
+		tlsCA, err := flags.GetString("tls-ca")
+		cobra.CheckErr(err)
+		insecure, err := flags.GetBool("insecure")
+		cobra.CheckErr(err)
+
+		cfg := internal.ServerConfig{Token: os.Getenv("WISPUB_API_TOKEN")}
+		if cfg.Token == "" {
+			return fmt.Errorf("WISPUB_API_TOKEN is not set")
+		}
+		cfg.InputDirs, err = flags.GetStringArray("input-dir")
+		cobra.CheckErr(err)
+		cfg.Input = internal.InputConfig{S3: internal.S3ConfigFromEnv()}
+		cfg.Input.TrustMetadata, err = flags.GetBool("trust-remote-metadata")
+		cobra.CheckErr(err)
+		historyPath, err := flags.GetString("history")
+		cobra.CheckErr(err)
+		if historyPath != "" {
+			cfg.History, err = internal.OpenHistory(historyPath)
+			if err != nil {
+				return err
+			}
+		}
+
+		setDefaultPort(brokerURL)
+
+		ctx := exitHandlerContext()
+
+		cmd.SilenceUsage = true
+		return doServeCmd(ctx, listen, brokerURL, clientID, tlsCA, insecure, cfg, metrics)
+	},
+}
+
+func init() {
+	flags := serveCmd.Flags()
+	flags.Bool("verbose", false, "Verbose logging. Same as --log-level=debug")
+	flags.String("listen", "127.0.0.1:8080", "Address to listen on")
+	flags.Bool("metrics", false, "Expose Prometheus metrics at /metrics. The endpoint does not require the API token")
+	flags.String("broker", "",
+		"MQTT broker URL to publish messages to. Can be tcp:// or ssl://. If the port is not included it "+
+			"will default to "+fmt.Sprintf("%v for tcp and %v for ssl.", defaultPort, defaultSSLPort))
+	flags.String("client-id", "", "MQTT client id. Defaults to a random id")
+	flags.String("tls-ca", "", "CA certificate file to verify the broker certificate, in addition to the system CAs")
+	flags.Bool("insecure", false, "If using TLS, don't verify the remote server certificate")
+	flags.String("history", "",
+		"Local history file of published notifications, used to warn when a data_id is reused for different content")
+	flags.StringArray("input-dir", nil,
+		"Directory local inputs must be in. May be repeated. Required to publish local inputs")
+	flags.Bool("trust-remote-metadata", false,
+		"For remote inputs, use the size and checksum from the server response headers when available rather "+
+			"than downloading the content")
+
+	cobra.CheckErr(cobra.MarkFlagRequired(flags, "broker"))
+
+	rootCmd.AddCommand(serveCmd)
+}
+
+// serveReconnectInterval is how often the broker connection is checked and re-made
+const serveReconnectInterval = 30 * time.Second
+
+func doServeCmd(
+	ctx context.Context,
+	listen string,
+	brokerURL *url.URL,
+	clientID, tlsCA string,
+	insecure bool,
+	cfg internal.ServerConfig,
+	metrics bool,
+) error {
+	publisher := internal.NewPublisher(brokerURL, clientID, tlsCA, insecure)
+	cfg.Publisher = publisher
+	defer func() {
+		if err := publisher.Close(); err != nil {
+			slog.Warn("unclean disconnect", "broker", brokerURL.Redacted(), "error", err)
+		}
+	}()
+
+	// keep the connection up so /readyz reflects whether messages can be published
+	go func() {
+		ticker := time.NewTicker(serveReconnectInterval)
+		defer ticker.Stop()
+		for {
+			if !publisher.Connected() {
+				slog.Debug("connecting", "broker", brokerURL.Redacted())
+				if err := publisher.Connect(ctx); err != nil {
+					slog.Error("failed to connect", "broker", brokerURL.Redacted(), "error", err)
+				}
+			}
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var handler http.Handler = internal.NewServer(cfg)
+	if metrics {
+		reg := prometheus.NewRegistry()
+		reg.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+		if err := internal.RegisterMetrics(reg); err != nil {
+			return fmt.Errorf("registering metrics: %w", err)
+		}
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
+		mux.Handle("/", handler)
+		handler = mux
+	}
+	handler = logRequests(handler)
+	srv := &http.Server{Addr: listen, Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+	shutdown := make(chan struct{})
+	go func() {
+		defer close(shutdown)
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			slog.Warn("unclean shutdown", "error", err)
+		}
+	}()
+
+	slog.Info("listening", "address", listen)
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("serving failed: %w", err)
+	}
+	// wait for in-flight requests to finish
+	<-shutdown
+	return nil
+}
+
+// statusRecorder records the status code written to a response
+type statusRecorder struct {
+	http.ResponseWriter
+	code int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	r.code = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+// logRequests logs each request at debug level
+func logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, code: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		slog.Debug("request", "method", r.Method, "path", r.URL.Path, "status", rec.code, "duration", time.Since(start))
+	})
+}
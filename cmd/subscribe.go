@@ -0,0 +1,421 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/template"
+	"time"
+
+	"github.com/eclipse/paho.golang/paho"
+	"github.com/google/uuid"
+	"github.com/spf13/cobra"
+	"gitlab.ssec.wisc.edu/dbrtn/wispub/internal"
+)
+
+const (
+	formatPretty = "pretty"
+	formatJSONL  = "jsonl"
+)
+
+var subscribeCmd = &cobra.Command{
+	Use:     "subscribe",
+	Aliases: []string{"sub"},
+	Short:   "Subscribe to notification messages",
+	Long: `Subscribe to a WIS 2.0 MQTT broker and print the notification messages received.
+
+Each message is validated against the WIS2 Notification Message specification and any
+problems are logged. The command exits with an error if any invalid messages were received,
+or if --count messages were not received before --timeout, so it can be used to check
+published messages arrive.
+
+With --download the data referred to by the canonical link of each valid message is
+downloaded to a directory and verified against the message length and integrity. Files
+are only written once verified. Failed downloads are queued and retried, and the command
+exits with an error if any could not be downloaded.
+
+The --download-path template has access to the following fields:
+	{{.Topic}}    the message topic
+	{{.Levels}}   the topic levels, e.g., {{index .Levels 3}} is the centre-id
+	{{.DataID}}   properties.data_id
+	{{.Filename}} the base name of the canonical link path
+	{{.Time}}     the message pubtime, plus {{.Year}}, {{.Month}}, {{.Day}}, {{.Hour}}, {{.Minute}} and {{.Jday}}
+`,
+	Example: `
+export WISPUB_BROKER_USER=<username>
+export WISPUB_BROKER_PASSWD=<password>
+
+wispub subscribe \
+	--broker=tcp://localhost \
+	--topic='origin/a/wis2/+/data/#' \
+	--count=1 \
+	--timeout=1m
+
+wispub subscribe \
+	--broker=ssl://globalbroker.example.org \
+	--topic='cache/a/wis2/+/data/core/weather/#' \
+	--download=./data \
+	--download-path='{{index .Levels 3}}/{{.Year}}{{.Month}}{{.Day}}/{{.Filename}}'
+`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		flags := cmd.Flags()
+		broker, err := flags.GetString("broker")
+		cobra.CheckErr(err)
+		brokerURL, err := url.Parse(broker)
+		if err != nil {
+			return fmt.Errorf("invalid broker URL")
+		}
+		topics, err := flags.GetStringArray("topic")
+		cobra.CheckErr(err)
+		clientID, err := flags.GetString("client-id")
+		cobra.CheckErr(err)
+		if clientID == "" {
+			clientID = "wispub-" + uuid.New().String()[:8]
+		}
+		tlsCA, err := flags.GetString("tls-ca")
+		cobra.CheckErr(err)
+		insecure, err := flags.GetBool("insecure")
+		cobra.CheckErr(err)
+
+		opts := subscribeOptions{}
+		opts.Count, err = flags.GetInt("count")
+		cobra.CheckErr(err)
+		opts.Timeout, err = flags.GetDuration("timeout")
+		cobra.CheckErr(err)
+		opts.Format, err = flags.GetString("format")
+		cobra.CheckErr(err)
+		if opts.Format != formatPretty && opts.Format != formatJSONL {
+			return fmt.Errorf("invalid --format %q, expected %s or %s", opts.Format, formatPretty, formatJSONL)
+		}
+		output, err := flags.GetString("output")
+		cobra.CheckErr(err)
+		opts.Output = os.Stdout
+		if output != "" && output != "-" {
+			f, err := os.OpenFile(output, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+			if err != nil {
+				return fmt.Errorf("opening output: %w", err)
+			}
+			defer f.Close()
+			opts.Output = f
+		}
+
+		opts.Download.Dir, err = flags.GetString("download")
+		cobra.CheckErr(err)
+		opts.DownloadPath, err = flags.GetString("download-path")
+		cobra.CheckErr(err)
+		if _, err := template.New("download-path").Parse(opts.DownloadPath); err != nil {
+			return fmt.Errorf("invalid --download-path template: %w", err)
+		}
+		opts.Download.Attempts, err = flags.GetInt("download-attempts")
+		cobra.CheckErr(err)
+		opts.Download.RetryWait, err = flags.GetDuration("download-retry-wait")
+		cobra.CheckErr(err)
+		opts.DownloadWorkers, err = flags.GetInt("download-workers")
+		cobra.CheckErr(err)
+		if opts.DownloadWorkers < 1 {
+			return fmt.Errorf("--download-workers must be at least 1")
+		}
+
+		setDefaultPort(brokerURL)
+
+		ctx := exitHandlerContext()
+
+		cmd.SilenceUsage = true
+		return doSubscribeCmd(ctx, brokerURL, clientID, tlsCA, topics, opts, insecure)
+	},
+}
+
+// subscribeOptions configure how received messages are handled
+type subscribeOptions struct {
+	// Count is the number of messages to receive before exiting, or 0 for no limit
+	Count int
+	// Timeout is how long to wait for messages before exiting, or 0 for no limit
+	Timeout time.Duration
+	Format  string
+	Output  io.Writer
+	// Download configures downloading the data for received messages if Download.Dir
+	// is set
+	Download        internal.Downloader
+	DownloadPath    string
+	DownloadWorkers int
+}
+
+// downloadTemplateContext is the data available to the --download-path template
+type downloadTemplateContext struct {
+	Topic    string
+	Levels   []string
+	DataID   string
+	Filename string
+	// Time is the message pubtime
+	Time                                 time.Time
+	Year, Month, Day, Hour, Minute, Jday string
+}
+
+// receivedMessage is a received message written in the jsonl format
+type receivedMessage struct {
+	Topic    string   `json:"topic"`
+	Received string   `json:"received"`
+	Valid    bool     `json:"valid"`
+	Problems []string `json:"problems,omitempty"`
+	// Message is the message JSON, or a string if the message is not JSON
+	Message any `json:"message"`
+}
+
+func init() {
+	flags := subscribeCmd.Flags()
+	flags.Bool("verbose", false, "Verbose logging. Same as --log-level=debug")
+	flags.String("broker", "",
+		"MQTT broker URL to subscribe to. Can be tcp:// or ssl://. If the port is not included it "+
+			"will default to "+fmt.Sprintf("%v for tcp and %v for ssl.", defaultPort, defaultSSLPort))
+	flags.StringArrayP("topic", "t", nil, "Topic filter to subscribe to, which may include + and # wildcards. May be repeated")
+	flags.String("client-id", "", "MQTT client id. Defaults to a random id")
+	flags.String("tls-ca", "", "CA certificate file to verify the broker certificate, in addition to the system CAs")
+	flags.Bool("insecure", false, "If using TLS, don't verify the remote server certificate")
+	flags.IntP("count", "n", 0, "Exit after receiving this many messages")
+	flags.Duration("timeout", 0, "Exit after this long. It is an error if --count messages were not received")
+	flags.String("format", formatPretty,
+		"Output format. One of pretty, for the topic followed by the indented message, or jsonl, for a JSON "+
+			"object per message with the topic, receive time, validation problems and message")
+	flags.StringP("output", "o", "", "File to append received messages to. Defaults to stdout")
+	flags.String("download", "", "Directory to download the data for each valid message to")
+	flags.String("download-path", "{{.Topic}}/{{.Filename}}",
+		"Template for the path of downloaded files relative to --download. See above for the fields available")
+	flags.Int("download-attempts", 3, "Number of times to attempt each download before giving up")
+	flags.Duration("download-retry-wait", 5*time.Second, "Wait before retrying a failed download, doubling for each further attempt")
+	flags.Int("download-workers", 4, "Number of concurrent downloads")
+
+	cobra.CheckErr(cobra.MarkFlagRequired(flags, "broker"))
+	cobra.CheckErr(cobra.MarkFlagRequired(flags, "topic"))
+
+	rootCmd.AddCommand(subscribeCmd)
+}
+
+func doSubscribeCmd(
+	ctx context.Context,
+	brokerURL *url.URL,
+	clientID, tlsCA string,
+	topics []string,
+	opts subscribeOptions,
+	insecure bool,
+) error {
+	var downloads *downloadQueue
+	if opts.Download.Dir != "" {
+		// downloads are not cancelled by the timeout so queued downloads can complete
+		downloads = startDownloadQueue(ctx, opts)
+		// wait on all returns so workers are not left running
+		defer downloads.wait()
+	}
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+
+	slog.Debug("connecting", "broker", brokerURL.Redacted())
+	received := make(chan *paho.Publish, 100)
+	handler := func(p *paho.Publish) {
+		select {
+		case received <- p:
+		case <-ctx.Done():
+		}
+	}
+	client, err := internal.NewSubscriber(ctx, brokerURL, clientID, tlsCA, insecure, handler)
+	if err != nil {
+		return fmt.Errorf("failed to create broker: %w", err)
+	}
+	defer func() {
+		if err := client.Disconnect(&paho.Disconnect{ReasonCode: 0}); err != nil {
+			slog.Warn("unclean disconnect", "error", err)
+		}
+	}()
+
+	if err := internal.Subscribe(ctx, client, internal.QosAtLeastOnce, topics...); err != nil {
+		return err
+	}
+	slog.Debug("subscribed", "broker", brokerURL.Redacted(), "filters", topics)
+
+	count, invalid := 0, 0
+	for opts.Count == 0 || count < opts.Count {
+		var p *paho.Publish
+		select {
+		case p = <-received:
+		case <-ctx.Done():
+		}
+		if p == nil {
+			break
+		}
+		count++
+		msg := newReceivedMessage(p)
+		if !msg.Valid {
+			invalid++
+			slog.Warn("invalid notification", "topic", p.Topic, "problems", msg.Problems)
+		}
+		if err := writeReceivedMessage(opts.Output, opts.Format, msg); err != nil {
+			return fmt.Errorf("writing message: %w", err)
+		}
+		if downloads != nil && msg.Valid {
+			downloads.add(p.Topic, p.Payload)
+		}
+	}
+
+	if downloads != nil {
+		slog.Debug("waiting for queued downloads")
+		if failed := downloads.wait(); failed > 0 {
+			return fmt.Errorf("%d downloads failed", failed)
+		}
+	}
+	if invalid > 0 {
+		return fmt.Errorf("%d of %d messages received were invalid", invalid, count)
+	}
+	if opts.Count > 0 && count < opts.Count {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("timed out after receiving %d of %d messages", count, opts.Count)
+		}
+		return fmt.Errorf("interrupted after receiving %d of %d messages", count, opts.Count)
+	}
+	return nil
+}
+
+func newReceivedMessage(p *paho.Publish) receivedMessage {
+	msg := receivedMessage{
+		Topic:    p.Topic,
+		Received: internal.FormatPubTime(time.Now(), 0),
+		Valid:    true,
+		Message:  string(p.Payload),
+	}
+	if json.Valid(p.Payload) {
+		msg.Message = json.RawMessage(p.Payload)
+	}
+	var verr *internal.ValidationError
+	if err := internal.ValidateNotification(p.Payload); errors.As(err, &verr) {
+		msg.Valid, msg.Problems = false, verr.Problems
+	}
+	return msg
+}
+
+func writeReceivedMessage(w io.Writer, format string, msg receivedMessage) error {
+	if format == formatJSONL {
+		dat, err := json.Marshal(msg)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(append(dat, '\n'))
+		return err
+	}
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "# %s %s\n", msg.Received, msg.Topic)
+	if raw, ok := msg.Message.(json.RawMessage); ok {
+		if err := json.Indent(buf, raw, "", "  "); err != nil {
+			return err
+		}
+	} else {
+		buf.WriteString(msg.Message.(string))
+	}
+	buf.WriteString("\n")
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// downloadQueue downloads the data for received messages using a pool of workers so
+// slow or retried downloads do not hold up receiving messages.
+type downloadQueue struct {
+	ctx    context.Context
+	opts   subscribeOptions
+	jobs   chan downloadJob
+	wg     sync.WaitGroup
+	failed atomic.Int64
+	closed sync.Once
+}
+
+type downloadJob struct {
+	topic   string
+	payload []byte
+}
+
+func startDownloadQueue(ctx context.Context, opts subscribeOptions) *downloadQueue {
+	q := &downloadQueue{ctx: ctx, opts: opts, jobs: make(chan downloadJob, 1000)}
+	for i := 0; i < opts.DownloadWorkers; i++ {
+		q.wg.Add(1)
+		go func() {
+			defer q.wg.Done()
+			for job := range q.jobs {
+				if err := q.download(job); err != nil {
+					q.failed.Add(1)
+					slog.Error("download failed", "topic", job.topic, "error", err)
+				}
+			}
+		}()
+	}
+	return q
+}
+
+// add queues a download, blocking if the queue is full.
+func (q *downloadQueue) add(topic string, payload []byte) {
+	q.jobs <- downloadJob{topic: topic, payload: payload}
+}
+
+// wait waits for queued downloads to complete and returns the number that failed. It
+// may be called more than once.
+func (q *downloadQueue) wait() int64 {
+	q.closed.Do(func() { close(q.jobs) })
+	q.wg.Wait()
+	return q.failed.Load()
+}
+
+func (q *downloadQueue) download(job downloadJob) error {
+	msg, err := internal.DecodeNotification(job.payload)
+	if err != nil {
+		return err
+	}
+	link, integrity, err := internal.CanonicalLink(msg)
+	if err != nil {
+		return err
+	}
+	relpath, err := downloadPath(q.opts.DownloadPath, job.topic, msg, link)
+	if err != nil {
+		return err
+	}
+	size, err := q.opts.Download.Download(q.ctx, link.Href, link.Length, integrity, relpath)
+	if err != nil {
+		return fmt.Errorf("downloading %s: %w", link.Href, err)
+	}
+	slog.Debug("downloaded", "topic", job.topic, "data_id", msg.Properties.DataID, "message_id", msg.ID,
+		"url", link.Href, "path", relpath, "bytes", size)
+	return nil
+}
+
+func downloadPath(text, topic string, msg *internal.NotificationMsgV04, link *internal.Link) (string, error) {
+	href, err := url.Parse(link.Href)
+	if err != nil {
+		return "", fmt.Errorf("invalid canonical link: %w", err)
+	}
+	t, err := internal.ParseTimestamp(msg.Properties.PubTime)
+	if err != nil {
+		return "", fmt.Errorf("invalid pubtime: %w", err)
+	}
+	return renderTemplate("download-path", text, downloadTemplateContext{
+		Topic:    topic,
+		Levels:   strings.Split(topic, "/"),
+		DataID:   msg.Properties.DataID,
+		Filename: path.Base(href.Path),
+		Time:     t,
+		Year:     t.Format("2006"),
+		Month:    t.Format("01"),
+		Day:      t.Format("02"),
+		Hour:     t.Format("15"),
+		Minute:   t.Format("04"),
+		Jday:     t.Format("002"),
+	})
+}
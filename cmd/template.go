@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"text/template"
+	"time"
+)
+
+// templateContext is the data available to the data command templates, e.g., the topic
+// and staging path.
+type templateContext struct {
+	Satellite, Observation, Center string
+	// Filename is the base name of the input
+	Filename string
+	// Topic is the rendered topic and Levels its levels, e.g., {{index .Levels 3}} is
+	// the centre-id. They are not available to the topic template.
+	Topic  string
+	Levels []string
+	// Time is the product time, i.e., the start of --datetime, or the current time if
+	// not provided
+	Time                                 time.Time
+	Year, Month, Day, Hour, Minute, Jday string
+}
+
+func newTemplateContext(satellite, observation, center, filename string, t time.Time) templateContext {
+	t = t.UTC()
+	return templateContext{
+		Satellite:   satellite,
+		Observation: observation,
+		Center:      center,
+		Filename:    filename,
+		Time:        t,
+		Year:        t.Format("2006"),
+		Month:       t.Format("01"),
+		Day:         t.Format("02"),
+		Hour:        t.Format("15"),
+		Minute:      t.Format("04"),
+		Jday:        t.Format("002"),
+	}
+}
+
+func renderTemplate(name, text string, data any) (string, error) {
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid %s template: %w", name, err)
+	}
+	buf := &bytes.Buffer{}
+	if err := tmpl.Execute(buf, data); err != nil {
+		return "", fmt.Errorf("could not render %s template: %w", name, err)
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,208 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"gitlab.ssec.wisc.edu/dbrtn/wispub/internal"
+)
+
+const (
+	formatText = "text"
+	formatJSON = "json"
+)
+
+var validateCmd = &cobra.Command{
+	Use:     "validate [flags] FILE...",
+	Aliases: []string{"val"},
+	Short:   "Validate notification message or metadata files",
+	Long: `Validate notification message or WCMP2 metadata record files without publishing them,
+e.g., messages produced by other tools. A FILE of - reads from stdin.
+
+Notification messages are validated against the WIS2 Notification Message specification.
+Additional checks are run with:
+	--topic        the topic is a valid WIS2 topic and the message meets its data policy.
+	               A data_id that does not include the topic centre-id is a warning
+	--data-file    a local copy of the data matches the message length and checksum
+	--check-links  each link is reachable and serves content of the link length
+
+With --metadata files are validated as WMO Core Metadata Profile 2 records using the
+WCMP2 schema.
+
+The command exits with an error if any file is invalid. Warnings do not make a file
+invalid. Use --format=json for a report
+that can be used in CI pipelines.
+`,
+	Example: `
+wispub validate message.json
+
+wispub validate --topic=origin/a/wis2/us-ssec/data/core/weather --data-file=granule.nc message.json
+
+wispub validate --metadata --format=json record.json
+`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		flags := cmd.Flags()
+		metadata, err := flags.GetBool("metadata")
+		cobra.CheckErr(err)
+
+		checks := internal.NotificationChecks{}
+		checks.Topic, err = flags.GetString("topic")
+		cobra.CheckErr(err)
+		checks.DataFile, err = flags.GetString("data-file")
+		cobra.CheckErr(err)
+		checks.Links, err = flags.GetBool("check-links")
+		cobra.CheckErr(err)
+		checks.Timeout, err = flags.GetDuration("timeout")
+		cobra.CheckErr(err)
+		if checks.DataFile != "" && len(args) > 1 {
+			return fmt.Errorf("--data-file can only be used with a single FILE")
+		}
+		if metadata && (checks.Topic != "" || checks.DataFile != "") {
+			return fmt.Errorf("--topic and --data-file cannot be used with --metadata")
+		}
+
+		format, err := flags.GetString("format")
+		cobra.CheckErr(err)
+		if format != formatText && format != formatJSON {
+			return fmt.Errorf("invalid --format %q, expected %s or %s", format, formatText, formatJSON)
+		}
+
+		ctx := exitHandlerContext()
+
+		cmd.SilenceUsage = true
+		return doValidateCmd(ctx, args, metadata, checks, format)
+	},
+}
+
+// validationReport is the result of validating a file
+type validationReport struct {
+	File string `json:"file"`
+	// Kind is notification or metadata
+	Kind     string   `json:"kind"`
+	Valid    bool     `json:"valid"`
+	Problems []string `json:"problems"`
+	// Warnings are for what is recommended but not required, so do not make the file
+	// invalid
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+func init() {
+	flags := validateCmd.Flags()
+	flags.Bool("metadata", false, "Validate files as WCMP2 metadata records rather than notification messages")
+	flags.String("topic", "", "Topic the notification message is published to, to check it is consistent with the message")
+	flags.String("data-file", "", "Local copy of the data to check against the message length and checksum")
+	flags.Bool("check-links", false, "Check each link is reachable and serves content of the link length")
+	flags.Duration("timeout", 30*time.Second, "Timeout for checking each link")
+	flags.String("format", formatText, "Output format. One of text or json")
+
+	rootCmd.AddCommand(validateCmd)
+}
+
+func doValidateCmd(ctx context.Context, files []string, metadata bool, checks internal.NotificationChecks, format string) error {
+	reports := []validationReport{}
+	invalid := 0
+	for _, fpath := range files {
+		report := validateFile(ctx, fpath, metadata, checks)
+		if !report.Valid {
+			invalid++
+		}
+		reports = append(reports, report)
+	}
+
+	if err := writeValidationReports(os.Stdout, format, reports); err != nil {
+		return fmt.Errorf("writing report: %w", err)
+	}
+	if invalid > 0 {
+		return fmt.Errorf("%d of %d files are invalid", invalid, len(files))
+	}
+	return nil
+}
+
+func validateFile(ctx context.Context, fpath string, metadata bool, checks internal.NotificationChecks) validationReport {
+	report := validationReport{File: fpath, Kind: "notification", Problems: []string{}}
+	if metadata {
+		report.Kind = "metadata"
+	}
+
+	var dat []byte
+	var err error
+	if fpath == "-" {
+		dat, err = io.ReadAll(os.Stdin)
+	} else {
+		dat, err = os.ReadFile(fpath)
+	}
+	if err != nil {
+		report.Problems = append(report.Problems, err.Error())
+		return report
+	}
+
+	if metadata {
+		err = internal.ValidateMetadata(dat)
+	} else {
+		err = internal.ValidateNotification(dat)
+	}
+	var verr *internal.ValidationError
+	if errors.As(err, &verr) {
+		report.Problems = append(report.Problems, verr.Problems...)
+	} else if err != nil {
+		report.Problems = append(report.Problems, err.Error())
+	}
+
+	// the additional checks need a message that could be decoded
+	if !metadata && len(report.Problems) == 0 {
+		msg, err := internal.DecodeNotification(dat)
+		if err != nil {
+			report.Problems = append(report.Problems, err.Error())
+		} else {
+			problems, warnings := internal.CheckNotification(ctx, msg, checks)
+			report.Problems = append(report.Problems, problems...)
+			report.Warnings = warnings
+		}
+	}
+	if metadata && checks.Links && len(report.Problems) == 0 {
+		var record struct {
+			Links []internal.Link `json:"links"`
+		}
+		if err := json.Unmarshal(dat, &record); err != nil {
+			report.Problems = append(report.Problems, err.Error())
+		} else {
+			report.Problems = append(report.Problems, internal.CheckLinks(ctx, checks.Client, record.Links, checks.Timeout)...)
+		}
+	}
+
+	report.Valid = len(report.Problems) == 0
+	return report
+}
+
+func writeValidationReports(w io.Writer, format string, reports []validationReport) error {
+	if format == formatJSON {
+		dat, err := json.MarshalIndent(reports, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(append(dat, '\n'))
+		return err
+	}
+
+	for _, report := range reports {
+		status := "valid"
+		if !report.Valid {
+			status = "invalid"
+		}
+		fmt.Fprintf(w, "%s: %s %s\n", report.File, status, report.Kind)
+		for _, problem := range report.Problems {
+			fmt.Fprintf(w, "  - %s\n", problem)
+		}
+		for _, warning := range report.Warnings {
+			fmt.Fprintf(w, "  - warning: %s\n", warning)
+		}
+	}
+	return nil
+}
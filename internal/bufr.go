@@ -0,0 +1,824 @@
+package internal
+
+import (
+	"bytes"
+	"embed"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The embedded tables are a subset of the WMO BUFR master tables covering station
+// identification, time and location. They use the same CSV layout as the WMO published
+// tables (https://github.com/wmo-im/BUFR4) so the full tables can be loaded with
+// LoadBUFRTables.
+//
+//go:embed tables/BUFRCREX_TableB_en.csv tables/BUFR_TableD_en.csv
+var bufrTableFS embed.FS
+
+const (
+	bufrTableBFile = "BUFRCREX_TableB_en.csv"
+	bufrTableDFile = "BUFR_TableD_en.csv"
+)
+
+// Descriptors used for notifications
+const (
+	descWMOBlock      = 1001
+	descWMOStation    = 1002
+	descWigosSeries   = 1125
+	descWigosIssuer   = 1126
+	descWigosIssueNo  = 1127
+	descWigosLocalID  = 1128
+	descYear          = 4001
+	descMonth         = 4002
+	descDay           = 4003
+	descHour          = 4004
+	descMinute        = 4005
+	descSecond        = 4006
+	descLatHigh       = 5001
+	descLatCoarse     = 5002
+	descLonHigh       = 6001
+	descLonCoarse     = 6002
+	descFactorShort   = 31000
+	descFactor        = 31001
+	descFactorExt     = 31002
+	descRepFactor     = 31011
+	descRepFactorExt  = 31012
+	descAssocFieldSig = 31021
+)
+
+var errBUFRUnsupported = errors.New("unsupported")
+
+// maxBUFRSequenceDepth limits the nesting of Table D sequences so a sequence that
+// includes itself, e.g., from user tables, fails rather than recursing forever
+const maxBUFRSequenceDepth = 32
+
+// bufrElement is a Table B element descriptor
+type bufrElement struct {
+	unit  string
+	scale int
+	ref   int64
+	width int
+}
+
+func (e bufrElement) isChar() bool { return e.unit == "CCITT IA5" }
+
+func (e bufrElement) isCodeOrFlag() bool {
+	return strings.HasPrefix(e.unit, "Code table") || strings.HasPrefix(e.unit, "Flag table")
+}
+
+type bufrTables struct {
+	sync.RWMutex
+	b map[int]bufrElement
+	d map[int][]int
+}
+
+var bufrTableRegistry = &bufrTables{b: map[int]bufrElement{}, d: map[int][]int{}}
+
+func init() {
+	sub, err := fs.Sub(bufrTableFS, "tables")
+	if err == nil {
+		err = bufrTableRegistry.load(sub)
+	}
+	if err != nil {
+		panic(fmt.Sprintf("loading embedded bufr tables: %s", err))
+	}
+}
+
+// LoadBUFRTables loads WMO BUFR master tables from a directory containing
+// BUFRCREX_TableB_en.csv and/or BUFR_TableD_en.csv, in the format published by WMO. The
+// descriptors are added to, and override, the embedded tables.
+func LoadBUFRTables(dir string) error {
+	return bufrTableRegistry.load(os.DirFS(dir))
+}
+
+func (t *bufrTables) load(fsys fs.FS) error {
+	found := false
+	for _, name := range []string{bufrTableBFile, bufrTableDFile} {
+		f, err := fsys.Open(name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		found = true
+		if name == bufrTableBFile {
+			err = t.loadB(f)
+		} else {
+			err = t.loadD(f)
+		}
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	if !found {
+		return fmt.Errorf("no %s or %s found", bufrTableBFile, bufrTableDFile)
+	}
+	return nil
+}
+
+// readTableCSV returns the rows of a table CSV as maps of column name to value
+func readTableCSV(r io.Reader, required ...string) ([]map[string]string, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.LazyQuotes = true
+	header, err := cr.Read()
+	if err != nil {
+		return nil, err
+	}
+	cols := map[string]int{}
+	for i, name := range header {
+		cols[strings.TrimPrefix(strings.TrimSpace(name), "\ufeff")] = i
+	}
+	for _, name := range required {
+		if _, ok := cols[name]; !ok {
+			return nil, fmt.Errorf("missing %s column", name)
+		}
+	}
+	rows := []map[string]string{}
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		row := map[string]string{}
+		for name, i := range cols {
+			if i < len(rec) {
+				row[name] = strings.TrimSpace(rec[i])
+			}
+		}
+		rows = append(rows, row)
+	}
+}
+
+func (t *bufrTables) loadB(r io.Reader) error {
+	rows, err := readTableCSV(r, "FXY", "BUFR_Unit", "BUFR_Scale", "BUFR_ReferenceValue", "BUFR_DataWidth_Bits")
+	if err != nil {
+		return err
+	}
+	elements := map[int]bufrElement{}
+	for _, row := range rows {
+		fxy, err := strconv.Atoi(row["FXY"])
+		if err != nil {
+			return fmt.Errorf("invalid FXY %q", row["FXY"])
+		}
+		elem := bufrElement{unit: row["BUFR_Unit"]}
+		elem.scale, err = strconv.Atoi(row["BUFR_Scale"])
+		if err != nil {
+			return fmt.Errorf("%06d: invalid scale", fxy)
+		}
+		elem.ref, err = strconv.ParseInt(row["BUFR_ReferenceValue"], 10, 64)
+		if err != nil {
+			return fmt.Errorf("%06d: invalid reference value", fxy)
+		}
+		elem.width, err = strconv.Atoi(row["BUFR_DataWidth_Bits"])
+		if err != nil {
+			return fmt.Errorf("%06d: invalid width", fxy)
+		}
+		elements[fxy] = elem
+	}
+	t.Lock()
+	defer t.Unlock()
+	for fxy, elem := range elements {
+		t.b[fxy] = elem
+	}
+	return nil
+}
+
+func (t *bufrTables) loadD(r io.Reader) error {
+	rows, err := readTableCSV(r, "FXY1", "FXY2")
+	if err != nil {
+		return err
+	}
+	seqs := map[int][]int{}
+	for _, row := range rows {
+		seq, err := strconv.Atoi(row["FXY1"])
+		if err != nil {
+			return fmt.Errorf("invalid FXY1 %q", row["FXY1"])
+		}
+		desc, err := strconv.Atoi(row["FXY2"])
+		if err != nil {
+			return fmt.Errorf("invalid FXY2 %q", row["FXY2"])
+		}
+		seqs[seq] = append(seqs[seq], desc)
+	}
+	t.Lock()
+	defer t.Unlock()
+	for seq, descs := range seqs {
+		t.d[seq] = descs
+	}
+	return nil
+}
+
+func (t *bufrTables) element(desc int) (bufrElement, bool) {
+	t.RLock()
+	defer t.RUnlock()
+	e, ok := t.b[desc]
+	return e, ok
+}
+
+func (t *bufrTables) sequence(desc int) ([]int, bool) {
+	t.RLock()
+	defer t.RUnlock()
+	s, ok := t.d[desc]
+	return s, ok
+}
+
+type bitReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *bitReader) read(n int) (uint64, error) {
+	if n > 64 {
+		return 0, fmt.Errorf("cannot read %d bits", n)
+	}
+	if r.pos+n > len(r.data)*8 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	var v uint64
+	for i := 0; i < n; i++ {
+		bit := (r.data[r.pos/8] >> (7 - uint(r.pos%8))) & 1
+		v = v<<1 | uint64(bit)
+		r.pos++
+	}
+	return v, nil
+}
+
+func (r *bitReader) readString(nbytes int) (string, bool, error) {
+	buf := make([]byte, nbytes)
+	allOnes := true
+	for i := range buf {
+		v, err := r.read(8)
+		if err != nil {
+			return "", false, err
+		}
+		buf[i] = byte(v)
+		allOnes = allOnes && v == 0xff
+	}
+	return strings.TrimRight(string(buf), " \x00"), allOnes, nil
+}
+
+func allOnes(v uint64, width int) bool {
+	return width > 0 && width < 64 && v == (uint64(1)<<width)-1
+}
+
+// bufrValue is a decoded element value
+type bufrValue struct {
+	num     float64
+	str     string
+	missing bool
+}
+
+// bufrMessage is the part of a BUFR message required for decoding section 4
+type bufrMessage struct {
+	edition     int
+	subsets     int
+	compressed  bool
+	descriptors []int
+	data        []byte
+	// typical time from section 1
+	typical time.Time
+}
+
+// parseBUFRMessage parses the BUFR message at the start of dat, returning the message
+// and its total length.
+func parseBUFRMessage(dat []byte) (*bufrMessage, int, error) {
+	if len(dat) < 8 || string(dat[:4]) != "BUFR" {
+		return nil, 0, fmt.Errorf("not a bufr message")
+	}
+	total := int(uint24(dat[4:]))
+	msg := &bufrMessage{edition: int(dat[7])}
+	if msg.edition != 3 && msg.edition != 4 {
+		return nil, 0, fmt.Errorf("unsupported bufr edition %d", msg.edition)
+	}
+	if total > len(dat) {
+		return nil, 0, fmt.Errorf("truncated bufr message")
+	}
+	dat = dat[:total]
+
+	// section 1
+	off := 8
+	sec1, err := bufrSection(dat, off)
+	if err != nil {
+		return nil, 0, fmt.Errorf("section 1: %w", err)
+	}
+	var hasSec2 bool
+	if msg.edition == 4 {
+		if len(sec1) < 22 {
+			return nil, 0, fmt.Errorf("section 1 too short")
+		}
+		hasSec2 = sec1[9]&0x80 != 0
+		msg.typical = time.Date(int(sec1[15])<<8|int(sec1[16]), time.Month(sec1[17]), int(sec1[18]),
+			int(sec1[19]), int(sec1[20]), int(sec1[21]), 0, time.UTC)
+	} else {
+		if len(sec1) < 17 {
+			return nil, 0, fmt.Errorf("section 1 too short")
+		}
+		hasSec2 = sec1[7]&0x80 != 0
+		year := int(sec1[12])
+		// year of century
+		if year <= 50 {
+			year += 2000
+		} else {
+			year += 1900
+		}
+		msg.typical = time.Date(year, time.Month(sec1[13]), int(sec1[14]), int(sec1[15]), int(sec1[16]), 0, 0, time.UTC)
+	}
+	off += len(sec1)
+
+	if hasSec2 {
+		sec2, err := bufrSection(dat, off)
+		if err != nil {
+			return nil, 0, fmt.Errorf("section 2: %w", err)
+		}
+		off += len(sec2)
+	}
+
+	sec3, err := bufrSection(dat, off)
+	if err != nil {
+		return nil, 0, fmt.Errorf("section 3: %w", err)
+	}
+	if len(sec3) < 7 {
+		return nil, 0, fmt.Errorf("section 3 too short")
+	}
+	msg.subsets = int(sec3[4])<<8 | int(sec3[5])
+	msg.compressed = sec3[6]&0x40 != 0
+	for i := 7; i+1 < len(sec3); i += 2 {
+		f := int(sec3[i] >> 6)
+		x := int(sec3[i] & 0x3f)
+		y := int(sec3[i+1])
+		msg.descriptors = append(msg.descriptors, f*100000+x*1000+y)
+	}
+	off += len(sec3)
+
+	sec4, err := bufrSection(dat, off)
+	if err != nil {
+		return nil, 0, fmt.Errorf("section 4: %w", err)
+	}
+	if len(sec4) < 4 {
+		return nil, 0, fmt.Errorf("section 4 too short")
+	}
+	msg.data = sec4[4:]
+	return msg, total, nil
+}
+
+func uint24(b []byte) uint32 { return uint32(b[0])<<16 | uint32(b[1])<<8 | uint32(b[2]) }
+
+func bufrSection(dat []byte, off int) ([]byte, error) {
+	if off+3 > len(dat) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	n := int(uint24(dat[off:]))
+	if n < 3 || off+n > len(dat) {
+		return nil, fmt.Errorf("invalid section length %d", n)
+	}
+	return dat[off : off+n], nil
+}
+
+// bufrDecoder decodes section 4 data, calling visit for each element with a value for
+// each subset being decoded, i.e., all subsets for compressed data, otherwise one.
+type bufrDecoder struct {
+	tables     *bufrTables
+	r          *bitReader
+	compressed bool
+	nsubsets   int
+	visit      func(desc int, vals []bufrValue)
+	// depth of Table D sequences being decoded
+	depth int
+
+	// operator state
+	widthDelta, scaleDelta int
+	incScale               int
+	charWidth              int
+	assocWidth             int
+	localWidth             int
+}
+
+func (d *bufrDecoder) reset() {
+	d.widthDelta, d.scaleDelta, d.incScale, d.charWidth, d.assocWidth, d.localWidth = 0, 0, 0, 0, 0, 0
+}
+
+func (d *bufrDecoder) walk(descs []int) error {
+	for i := 0; i < len(descs); i++ {
+		desc := descs[i]
+		f, x, y := desc/100000, desc/1000%100, desc%1000
+		switch f {
+		case 0:
+			if _, err := d.element(desc); err != nil {
+				return err
+			}
+		case 1:
+			count := y
+			start := i + 1
+			if y == 0 {
+				if start >= len(descs) {
+					return fmt.Errorf("missing delayed replication factor")
+				}
+				vals, err := d.element(descs[start])
+				if err != nil {
+					return err
+				}
+				switch descs[start] {
+				case descFactorShort, descFactor, descFactorExt, descRepFactor, descRepFactorExt:
+				default:
+					return fmt.Errorf("%06d is not a delayed replication factor", descs[start])
+				}
+				if len(vals) == 0 {
+					// the factor was skipped as a local descriptor by 2-06-YYY
+					return fmt.Errorf("%06d: no delayed replication factor value", descs[start])
+				}
+				count = int(vals[0].num)
+				start++
+			}
+			if start+x > len(descs) {
+				return fmt.Errorf("replication of %d descriptors exceeds sequence", x)
+			}
+			for n := 0; n < count; n++ {
+				if err := d.walk(descs[start : start+x]); err != nil {
+					return err
+				}
+			}
+			i = start + x - 1
+		case 2:
+			if err := d.operator(x, y); err != nil {
+				return fmt.Errorf("%06d: %w", desc, err)
+			}
+		case 3:
+			seq, ok := d.tables.sequence(desc)
+			if !ok {
+				return fmt.Errorf("%06d: %w sequence", desc, errBUFRUnsupported)
+			}
+			if d.depth >= maxBUFRSequenceDepth {
+				return fmt.Errorf("%06d: sequences nested more than %d deep", desc, maxBUFRSequenceDepth)
+			}
+			d.depth++
+			err := d.walk(seq)
+			d.depth--
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (d *bufrDecoder) operator(x, y int) error {
+	switch x {
+	case 1:
+		d.widthDelta = 0
+		if y != 0 {
+			d.widthDelta = y - 128
+		}
+	case 2:
+		d.scaleDelta = 0
+		if y != 0 {
+			d.scaleDelta = y - 128
+		}
+	case 4:
+		d.assocWidth = y
+	case 5:
+		// inline character data
+		if _, err := d.chars(y); err != nil {
+			return err
+		}
+	case 6:
+		d.localWidth = y
+	case 7:
+		d.incScale = y
+	case 8:
+		d.charWidth = y * 8
+	default:
+		return fmt.Errorf("%w operator", errBUFRUnsupported)
+	}
+	return nil
+}
+
+func (d *bufrDecoder) element(desc int) ([]bufrValue, error) {
+	if d.localWidth > 0 {
+		// skip a local descriptor of the width given by 2-06-YYY
+		width := d.localWidth
+		d.localWidth = 0
+		_, err := d.raw(width, false)
+		return nil, err
+	}
+	elem, ok := d.tables.element(desc)
+	if !ok {
+		return nil, fmt.Errorf("%06d: %w element", desc, errBUFRUnsupported)
+	}
+	x := desc / 1000 % 100
+	if d.assocWidth > 0 && x != 31 {
+		if _, err := d.raw(d.assocWidth, false); err != nil {
+			return nil, err
+		}
+	}
+
+	var vals []bufrValue
+	var err error
+	if elem.isChar() {
+		width := elem.width
+		if d.charWidth > 0 {
+			width = d.charWidth
+		}
+		vals, err = d.chars(width / 8)
+	} else {
+		width, scale, ref := elem.width, elem.scale, elem.ref
+		if !elem.isCodeOrFlag() {
+			width += d.widthDelta
+			scale += d.scaleDelta
+			if d.incScale > 0 {
+				scale += d.incScale
+				ref *= int64(math.Pow10(d.incScale))
+				width += (10*d.incScale + 2) / 3
+			}
+		}
+		var raw []rawValue
+		raw, err = d.raw(width, x != 31)
+		vals = make([]bufrValue, len(raw))
+		for i, v := range raw {
+			vals[i] = bufrValue{missing: v.missing, num: float64(int64(v.v)+ref) / math.Pow10(scale)}
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%06d: %w", desc, err)
+	}
+	if d.visit != nil {
+		d.visit(desc, vals)
+	}
+	return vals, nil
+}
+
+type rawValue struct {
+	v       uint64
+	missing bool
+}
+
+// raw reads a numeric value for each subset being decoded
+func (d *bufrDecoder) raw(width int, canBeMissing bool) ([]rawValue, error) {
+	r0, err := d.r.read(width)
+	if err != nil {
+		return nil, err
+	}
+	if !d.compressed {
+		return []rawValue{{v: r0, missing: canBeMissing && allOnes(r0, width)}}, nil
+	}
+	nbinc, err := d.r.read(6)
+	if err != nil {
+		return nil, err
+	}
+	vals := make([]rawValue, d.nsubsets)
+	for i := range vals {
+		if nbinc == 0 {
+			vals[i] = rawValue{v: r0, missing: canBeMissing && allOnes(r0, width)}
+			continue
+		}
+		inc, err := d.r.read(int(nbinc))
+		if err != nil {
+			return nil, err
+		}
+		vals[i] = rawValue{v: r0 + inc, missing: canBeMissing && allOnes(inc, int(nbinc))}
+	}
+	return vals, nil
+}
+
+// chars reads a character value for each subset being decoded
+func (d *bufrDecoder) chars(nbytes int) ([]bufrValue, error) {
+	s, missing, err := d.r.readString(nbytes)
+	if err != nil {
+		return nil, err
+	}
+	if !d.compressed {
+		return []bufrValue{{str: s, missing: missing}}, nil
+	}
+	nbinc, err := d.r.read(6)
+	if err != nil {
+		return nil, err
+	}
+	vals := make([]bufrValue, d.nsubsets)
+	for i := range vals {
+		if nbinc == 0 {
+			vals[i] = bufrValue{str: s, missing: missing}
+			continue
+		}
+		s, missing, err := d.r.readString(int(nbinc))
+		if err != nil {
+			return nil, err
+		}
+		vals[i] = bufrValue{str: s, missing: missing}
+	}
+	return vals, nil
+}
+
+// bufrObs are the values of a subset used for notifications
+type bufrObs struct {
+	vals map[int]bufrValue
+}
+
+func (o *bufrObs) set(desc int, v bufrValue) {
+	if _, ok := o.vals[desc]; !ok && !v.missing {
+		o.vals[desc] = v
+	}
+}
+
+func (o *bufrObs) num(descs ...int) (float64, bool) {
+	for _, desc := range descs {
+		if v, ok := o.vals[desc]; ok {
+			return v.num, true
+		}
+	}
+	return 0, false
+}
+
+// wigosID returns the WIGOS station identifier, or the identifier derived from the
+// traditional WMO block and station number.
+func (o *bufrObs) wigosID() string {
+	series, ok1 := o.num(descWigosSeries)
+	issuer, ok2 := o.num(descWigosIssuer)
+	issue, ok3 := o.num(descWigosIssueNo)
+	local, ok4 := o.vals[descWigosLocalID]
+	if ok1 && ok2 && ok3 && ok4 && local.str != "" {
+		return fmt.Sprintf("%d-%d-%d-%s", int(series), int(issuer), int(issue), local.str)
+	}
+	block, ok1 := o.num(descWMOBlock)
+	station, ok2 := o.num(descWMOStation)
+	if ok1 && ok2 {
+		return fmt.Sprintf("0-20000-0-%02d%03d", int(block), int(station))
+	}
+	return ""
+}
+
+func (o *bufrObs) location() (Position, bool) {
+	lat, ok1 := o.num(descLatHigh, descLatCoarse)
+	lon, ok2 := o.num(descLonHigh, descLonCoarse)
+	if !ok1 || !ok2 {
+		return nil, false
+	}
+	return Position{lon, lat}, true
+}
+
+func (o *bufrObs) time() (time.Time, bool) {
+	parts := make([]int, 6)
+	for i, desc := range []int{descYear, descMonth, descDay, descHour, descMinute, descSecond} {
+		v, ok := o.num(desc)
+		if !ok && desc != descSecond {
+			return time.Time{}, false
+		}
+		parts[i] = int(v)
+	}
+	return time.Date(parts[0], time.Month(parts[1]), parts[2], parts[3], parts[4], parts[5], 0, time.UTC), true
+}
+
+// decodeBUFRObs decodes the observation values for each subset of a message
+func decodeBUFRObs(msg *bufrMessage, tables *bufrTables) ([]*bufrObs, error) {
+	newObs := func() *bufrObs { return &bufrObs{vals: map[int]bufrValue{}} }
+	dec := &bufrDecoder{
+		tables:     tables,
+		r:          &bitReader{data: msg.data},
+		compressed: msg.compressed,
+		nsubsets:   msg.subsets,
+	}
+
+	if msg.compressed {
+		obs := make([]*bufrObs, msg.subsets)
+		for i := range obs {
+			obs[i] = newObs()
+		}
+		dec.visit = func(desc int, vals []bufrValue) {
+			for i, v := range vals {
+				obs[i].set(desc, v)
+			}
+		}
+		// Values for all subsets are decoded together so it is fine to stop at an
+		// unsupported descriptor if the station, time and location come before it.
+		if err := dec.walk(msg.descriptors); err != nil && !errors.Is(err, errBUFRUnsupported) {
+			return nil, err
+		}
+		return obs, nil
+	}
+
+	obs := []*bufrObs{}
+	for s := 0; s < msg.subsets; s++ {
+		cur := newObs()
+		obs = append(obs, cur)
+		dec.reset()
+		dec.visit = func(desc int, vals []bufrValue) { cur.set(desc, vals[0]) }
+		if err := dec.walk(msg.descriptors); err != nil {
+			// an unsupported descriptor is only fine in the last subset because the
+			// start of the next subset cannot be found otherwise
+			if errors.Is(err, errBUFRUnsupported) && s == msg.subsets-1 {
+				break
+			}
+			return nil, fmt.Errorf("subset %d: %w", s+1, err)
+		}
+	}
+	return obs, nil
+}
+
+// ExtractBUFRObs extracts the WIGOS station identifier, location and observation time
+// from the BUFR messages in a file. The file may contain multiple messages and messages
+// may contain multiple subsets, in which case the datetimes are the range of the
+// observation times, the geometry is the bounding box of the locations, and the WIGOS
+// identifier is only set if all the observations are from the same station.
+//
+// Only descriptors in the embedded tables, or those loaded with LoadBUFRTables, can be
+// decoded. This is sufficient for templates where the station identification, time
+// and location come first, which is the case for the common surface templates.
+func ExtractBUFRObs(fpath string) (*Extracted, error) {
+	dat, err := os.ReadFile(fpath)
+	if err != nil {
+		return nil, err
+	}
+
+	var all []*bufrObs
+	var typical []time.Time
+	for len(dat) > 0 {
+		idx := bytes.Index(dat, []byte("BUFR"))
+		if idx < 0 {
+			break
+		}
+		msg, n, err := parseBUFRMessage(dat[idx:])
+		if err != nil {
+			return nil, fmt.Errorf("message %d: %w", len(typical)+1, err)
+		}
+		obs, err := decodeBUFRObs(msg, bufrTableRegistry)
+		if err != nil {
+			return nil, fmt.Errorf("message %d: %w", len(typical)+1, err)
+		}
+		all = append(all, obs...)
+		typical = append(typical, msg.typical)
+		dat = dat[idx+n:]
+	}
+	if len(typical) == 0 {
+		return nil, fmt.Errorf("no bufr messages found")
+	}
+
+	zult := &Extracted{}
+	var times []time.Time
+	ids := map[string]bool{}
+	var positions []Position
+	for _, o := range all {
+		if t, ok := o.time(); ok {
+			times = append(times, t)
+		}
+		ids[o.wigosID()] = true
+		if pos, ok := o.location(); ok {
+			positions = append(positions, pos)
+		}
+	}
+	if len(times) == 0 {
+		// no observation times, so use the typical time of the messages
+		times = typical
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+	zult.Start = FormatDatetime(times[0], time.Second)
+	if end := FormatDatetime(times[len(times)-1], time.Second); end != zult.Start {
+		zult.End = end
+	}
+	if len(ids) == 1 {
+		for id := range ids {
+			zult.WigosID = id
+		}
+	}
+	zult.Geometry = boundingGeometry(positions)
+	return zult, nil
+}
+
+// boundingGeometry returns a point if all positions are the same, otherwise the bounding
+// box of the positions. nil is returned if there are no positions or the bounding box
+// has no area.
+func boundingGeometry(positions []Position) *Geometry {
+	if len(positions) == 0 {
+		return nil
+	}
+	west, south, east, north := positions[0][0], positions[0][1], positions[0][0], positions[0][1]
+	for _, pos := range positions[1:] {
+		west, east = math.Min(west, pos[0]), math.Max(east, pos[0])
+		south, north = math.Min(south, pos[1]), math.Max(north, pos[1])
+	}
+	if west == east && south == north {
+		geom := NewPoint(west, south)
+		if geom.Validate() != nil {
+			return nil
+		}
+		return geom
+	}
+	geom, err := newBBoxChecked(west, south, east, north)
+	if err != nil {
+		return nil
+	}
+	return geom
+}
@@ -0,0 +1,259 @@
+package internal
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type bitWriter struct {
+	buf []byte
+	n   int
+}
+
+func (w *bitWriter) write(v uint64, width int) {
+	for i := width - 1; i >= 0; i-- {
+		if w.n%8 == 0 {
+			w.buf = append(w.buf, 0)
+		}
+		if v>>uint(i)&1 == 1 {
+			w.buf[w.n/8] |= 1 << (7 - uint(w.n%8))
+		}
+		w.n++
+	}
+}
+
+func (w *bitWriter) str(s string, nbytes int) {
+	for i := 0; i < nbytes; i++ {
+		c := byte(' ')
+		if i < len(s) {
+			c = s[i]
+		}
+		w.write(uint64(c), 8)
+	}
+}
+
+// elem writes value v encoded for a Table B element
+func (w *bitWriter) elem(t *testing.T, desc int, v float64) {
+	e, ok := bufrTableRegistry.element(desc)
+	require.True(t, ok, desc)
+	w.write(uint64(int64(math.Round(v*math.Pow10(e.scale)))-e.ref), e.width)
+}
+
+// compressed writes the values of a Table B element for each subset in compressed form
+func (w *bitWriter) compressed(t *testing.T, desc int, vals ...float64) {
+	e, ok := bufrTableRegistry.element(desc)
+	require.True(t, ok, desc)
+	raw := []uint64{}
+	min, max := uint64(math.MaxUint64), uint64(0)
+	for _, v := range vals {
+		r := uint64(int64(math.Round(v*math.Pow10(e.scale))) - e.ref)
+		raw = append(raw, r)
+		if r < min {
+			min = r
+		}
+		if r > max {
+			max = r
+		}
+	}
+	w.write(min, e.width)
+	nbinc := 0
+	for max-min >= 1<<nbinc {
+		nbinc++
+	}
+	w.write(uint64(nbinc), 6)
+	if nbinc > 0 {
+		for _, r := range raw {
+			w.write(r-min, nbinc)
+		}
+	}
+}
+
+func sec(body ...byte) []byte {
+	n := len(body) + 3
+	return append([]byte{byte(n >> 16), byte(n >> 8), byte(n)}, body...)
+}
+
+// buildBUFR returns an edition 3 or 4 BUFR message. The section 1 typical time is
+// 2024-01-02 03:04:05 for edition 4 and 2024-01-02 03:04 for edition 3.
+func buildBUFR(edition, subsets int, compressed bool, descs []int, data []byte) []byte {
+	var sec1 []byte
+	if edition == 4 {
+		sec1 = sec(0, 0, 7, 0, 0, 0, 0, 2, 0, 0, 38, 0, 0x07, 0xe8, 1, 2, 3, 4, 5)
+	} else {
+		sec1 = sec(0, 0, 7, 0, 0, 2, 0, 13, 0, 24, 1, 2, 3, 4, 0)
+	}
+	flags := byte(0x80)
+	if compressed {
+		flags |= 0x40
+	}
+	body := []byte{0, byte(subsets >> 8), byte(subsets), flags}
+	for _, d := range descs {
+		f, x, y := d/100000, d/1000%100, d%1000
+		body = append(body, byte(f<<6|x), byte(y))
+	}
+	sec3 := sec(body...)
+	sec4 := sec(append([]byte{0}, data...)...)
+
+	msg := []byte{}
+	msg = append(msg, sec1...)
+	msg = append(msg, sec3...)
+	msg = append(msg, sec4...)
+	msg = append(msg, "7777"...)
+	n := len(msg) + 8
+	return append([]byte{'B', 'U', 'F', 'R', byte(n >> 16), byte(n >> 8), byte(n), byte(edition)}, msg...)
+}
+
+func writeBUFR(t *testing.T, msgs ...[]byte) string {
+	fpath := filepath.Join(t.TempDir(), "obs.bufr")
+	dat := []byte("ISMD01 KWBC 020300\r\r\n")
+	for _, msg := range msgs {
+		dat = append(dat, msg...)
+	}
+	require.NoError(t, os.WriteFile(fpath, dat, 0o644))
+	return fpath
+}
+
+func TestExtractBUFRObs(t *testing.T) {
+	t.Run("uncompressed", func(t *testing.T) {
+		w := &bitWriter{}
+		for _, minute := range []float64{0, 10} {
+			w.elem(t, descWMOBlock, 72)
+			w.elem(t, descWMOStation, 493)
+			w.elem(t, descYear, 2024)
+			w.elem(t, descMonth, 1)
+			w.elem(t, descDay, 2)
+			w.elem(t, descHour, 3)
+			w.elem(t, descMinute, minute)
+			w.elem(t, descLatCoarse, 43.07)
+			w.elem(t, descLonCoarse, -89.4)
+			// delayed replication of the block number
+			w.elem(t, descFactor, 2)
+			w.elem(t, descWMOBlock, 1)
+			w.elem(t, descWMOBlock, 2)
+		}
+		msg := buildBUFR(4, 2, false, []int{301001, 301011, 301012, 301023, 101000, 31001, 1001}, w.buf)
+		zult, err := ExtractBUFRObs(writeBUFR(t, msg))
+		require.NoError(t, err)
+		require.Equal(t, "0-20000-0-72493", zult.WigosID)
+		require.Equal(t, NewPoint(-89.4, 43.07), zult.Geometry)
+		require.Equal(t, "2024-01-02T03:00:00Z", zult.Start)
+		require.Equal(t, "2024-01-02T03:10:00Z", zult.End)
+	})
+
+	t.Run("compressed", func(t *testing.T) {
+		w := &bitWriter{}
+		w.compressed(t, descWigosSeries, 0, 0)
+		w.compressed(t, descWigosIssuer, 20000, 20000)
+		w.compressed(t, descWigosIssueNo, 0, 0)
+		// local identifiers of different stations
+		w.str("", 16)
+		w.write(16, 6)
+		w.str("72493", 16)
+		w.str("72494", 16)
+		w.compressed(t, descYear, 2024, 2024)
+		w.compressed(t, descMonth, 1, 1)
+		w.compressed(t, descDay, 2, 2)
+		w.compressed(t, descHour, 3, 3)
+		w.compressed(t, descMinute, 0, 0)
+		w.compressed(t, descLatHigh, 40, 43.5)
+		w.compressed(t, descLonHigh, -90, -89)
+		// a local descriptor that is not in the tables
+		msg := buildBUFR(4, 2, true, []int{301150, 301011, 301012, 301021, 63255}, w.buf)
+		zult, err := ExtractBUFRObs(writeBUFR(t, msg))
+		require.NoError(t, err)
+		require.Empty(t, zult.WigosID)
+		require.Equal(t, NewBBox(-90, 40, -89, 43.5), zult.Geometry)
+		require.Equal(t, "2024-01-02T03:00:00Z", zult.Start)
+		require.Empty(t, zult.End)
+	})
+
+	t.Run("multiple messages", func(t *testing.T) {
+		w := &bitWriter{}
+		w.elem(t, descWigosSeries, 0)
+		w.elem(t, descWigosIssuer, 20000)
+		w.elem(t, descWigosIssueNo, 0)
+		w.str("ABC12", 16)
+		msg4 := buildBUFR(4, 1, false, []int{301150}, w.buf)
+		msg3 := buildBUFR(3, 1, false, []int{301150}, w.buf)
+		zult, err := ExtractBUFRObs(writeBUFR(t, msg4, msg3))
+		require.NoError(t, err)
+		require.Equal(t, "0-20000-0-ABC12", zult.WigosID)
+		require.Nil(t, zult.Geometry)
+		// typical times from section 1
+		require.Equal(t, "2024-01-02T03:04:00Z", zult.Start)
+		require.Equal(t, "2024-01-02T03:04:05Z", zult.End)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		w := &bitWriter{}
+		w.elem(t, descWMOBlock, 72)
+		w.write(0, 8)
+		w.elem(t, descWMOBlock, 72)
+		// unsupported descriptor before the last subset
+		msg := buildBUFR(4, 2, false, []int{1001, 63255}, w.buf)
+		_, err := ExtractBUFRObs(writeBUFR(t, msg))
+		require.Error(t, err)
+
+		// truncated data
+		msg = buildBUFR(4, 1, false, []int{301011}, []byte{0})
+		_, err = ExtractBUFRObs(writeBUFR(t, msg))
+		require.Error(t, err)
+
+		_, err = ExtractBUFRObs(writeBUFR(t, []byte("not bufr")))
+		require.Error(t, err)
+
+		// delayed replication factor skipped as a local descriptor
+		w = &bitWriter{}
+		w.write(0, 8)
+		msg = buildBUFR(4, 1, false, []int{206008, 101000, 31001, 1001}, w.buf)
+		_, err = ExtractBUFRObs(writeBUFR(t, msg))
+		require.ErrorContains(t, err, "no delayed replication factor value")
+
+		// sequence that includes itself
+		tables := &bufrTables{b: map[int]bufrElement{}, d: map[int][]int{363000: {363000}}}
+		_, err = decodeBUFRObs(&bufrMessage{subsets: 1, descriptors: []int{363000}}, tables)
+		require.ErrorContains(t, err, "nested more than")
+	})
+
+	t.Run("auto", func(t *testing.T) {
+		w := &bitWriter{}
+		w.elem(t, descWMOBlock, 72)
+		w.write(0, 8)
+		w.elem(t, descWMOBlock, 72)
+		// unsupported descriptor before the last subset
+		msg := buildBUFR(4, 2, false, []int{1001, 63255}, w.buf)
+		extractor, err := NewExtractor(ExtractAuto, "application/bufr")
+		require.NoError(t, err)
+		zult, err := extractor(writeBUFR(t, msg))
+		require.NoError(t, err, "errors are warnings")
+		require.Equal(t, &Extracted{}, zult)
+	})
+}
+
+func TestLoadBUFRTables(t *testing.T) {
+	t.Cleanup(func() {
+		bufrTableRegistry.Lock()
+		delete(bufrTableRegistry.b, 63255)
+		bufrTableRegistry.Unlock()
+	})
+	dir := t.TempDir()
+	require.Error(t, LoadBUFRTables(dir))
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, bufrTableBFile), []byte(
+		"\ufeffFXY,ElementName_en,BUFR_Unit,BUFR_Scale,BUFR_ReferenceValue,BUFR_DataWidth_Bits,Status\n"+
+			"063255,Local element,Numeric,0,0,8,Operational\n"), 0o644))
+	require.NoError(t, LoadBUFRTables(dir))
+	elem, ok := bufrTableRegistry.element(63255)
+	require.True(t, ok)
+	require.Equal(t, 8, elem.width)
+	// embedded entries are kept
+	_, ok = bufrTableRegistry.element(descWMOBlock)
+	require.True(t, ok)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, bufrTableBFile), []byte("FXY,BUFR_Unit\n"), 0o644))
+	require.Error(t, LoadBUFRTables(dir))
+}
@@ -0,0 +1,267 @@
+package internal
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/eclipse/paho.golang/paho"
+)
+
+// CheckOptions configure a broker connectivity check
+type CheckOptions struct {
+	Broker   *url.URL
+	ClientID string
+	TLSCA    string
+	Insecure bool
+	// Topic, if set, is published a test message
+	Topic string
+	// Timeout is the timeout for each step
+	Timeout time.Duration
+}
+
+// CheckStep is the result of one step of a broker connectivity check
+type CheckStep struct {
+	Name     string
+	Duration time.Duration
+	// Details describe what was found, e.g., the certificate chain or server properties
+	Details []string
+	// Err is set if the step failed
+	Err error
+}
+
+func (s *CheckStep) OK() bool { return s.Err == nil }
+
+func (s *CheckStep) detail(format string, args ...any) {
+	s.Details = append(s.Details, fmt.Sprintf(format, args...))
+}
+
+// certExpiryWarning is how close to expiry a certificate must be to be reported
+const certExpiryWarning = 30 * 24 * time.Hour
+
+// CheckBroker diagnoses connecting and publishing to a broker by resolving its host,
+// connecting, performing the TLS handshake for ssl:// brokers, performing the MQTT
+// CONNECT and, if opts.Topic is set, publishing a test message. Steps run in order until
+// one fails, and the result of each step run is returned.
+func CheckBroker(ctx context.Context, opts CheckOptions) []*CheckStep {
+	steps := []*CheckStep{}
+	run := func(name string, fn func(ctx context.Context, step *CheckStep) error) bool {
+		step := &CheckStep{Name: name}
+		steps = append(steps, step)
+		stepCtx := ctx
+		if opts.Timeout > 0 {
+			var cancel context.CancelFunc
+			stepCtx, cancel = context.WithTimeout(ctx, opts.Timeout)
+			defer cancel()
+		}
+		start := time.Now()
+		step.Err = fn(stepCtx, step)
+		step.Duration = time.Since(start)
+		return step.OK()
+	}
+
+	u := opts.Broker
+	if u.Scheme != "tcp" && u.Scheme != "ssl" {
+		steps = append(steps, &CheckStep{Name: "url", Err: fmt.Errorf("unsupported url scheme: %s", u.Scheme)})
+		return steps
+	}
+
+	ok := run("dns", func(ctx context.Context, step *CheckStep) error {
+		addrs, err := net.DefaultResolver.LookupHost(ctx, u.Hostname())
+		if err != nil {
+			return err
+		}
+		step.detail("%s resolves to %s", u.Hostname(), strings.Join(addrs, ", "))
+		return nil
+	})
+	if !ok {
+		return steps
+	}
+
+	var conn net.Conn
+	ok = run("tcp", func(ctx context.Context, step *CheckStep) error {
+		var err error
+		conn, err = (&net.Dialer{}).DialContext(ctx, "tcp", u.Host)
+		if err != nil {
+			return err
+		}
+		step.detail("connected to %s", conn.RemoteAddr())
+		return nil
+	})
+	if !ok {
+		return steps
+	}
+	defer func() { conn.Close() }()
+
+	if u.Scheme == "ssl" {
+		ok = run("tls", func(ctx context.Context, step *CheckStep) error {
+			tlsConn, err := checkTLS(ctx, step, conn, u.Hostname(), opts.TLSCA, opts.Insecure)
+			if tlsConn != nil {
+				conn = tlsConn
+			}
+			return err
+		})
+		if !ok {
+			return steps
+		}
+	}
+
+	var client *paho.Client
+	ok = run("mqtt connect", func(ctx context.Context, step *CheckStep) error {
+		client = paho.NewClient(paho.ClientConfig{ClientID: opts.ClientID, Conn: conn})
+		user, passwd, err := brokerCredentials(u)
+		if err != nil {
+			return err
+		}
+		step.detail("user %q, client id %q", user, opts.ClientID)
+		ack, err := client.Connect(ctx, &paho.Connect{
+			KeepAlive:    30,
+			ClientID:     opts.ClientID,
+			CleanStart:   true,
+			Username:     user,
+			UsernameFlag: true,
+			Password:     []byte(passwd),
+			PasswordFlag: true,
+		})
+		if ack != nil {
+			step.detail("CONNACK reason code %d", ack.ReasonCode)
+			connackDetails(step, ack.Properties)
+		}
+		return err
+	})
+	if !ok {
+		return steps
+	}
+	defer disconnectWithin(client, conn, checkDisconnectTimeout)
+
+	if opts.Topic != "" {
+		run("publish", func(ctx context.Context, step *CheckStep) error {
+			payload := fmt.Sprintf(`{"wispub": "check", "time": %q}`, FormatPubTime(time.Now(), DefaultPubTimePrecision))
+			resp, err := client.Publish(ctx, &paho.Publish{
+				QoS:        QosAtLeastOnce,
+				Topic:      opts.Topic,
+				Properties: &paho.PublishProperties{ContentType: "application/json"},
+				Payload:    []byte(payload),
+			})
+			if resp != nil {
+				step.detail("PUBACK reason code %d: %s", resp.ReasonCode, PubReason(resp.ReasonCode))
+			}
+			return err
+		})
+	}
+	return steps
+}
+
+// checkDisconnectTimeout is how long to wait for a clean disconnect after checking
+const checkDisconnectTimeout = time.Second
+
+// disconnectWithin disconnects client, closing conn if paho has not stopped within
+// timeout. paho's Disconnect waits for its pinger, which misses being stopped if
+// Disconnect is called straight after connecting, and then runs until its first check
+// a quarter of the keep alive later.
+func disconnectWithin(client *paho.Client, conn net.Conn, timeout time.Duration) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		client.Disconnect(&paho.Disconnect{ReasonCode: 0})
+	}()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		conn.Close()
+	}
+}
+
+// checkTLS performs the TLS handshake, reporting the certificate chain and whether it is
+// valid for host. Verification is done after the handshake so the chain can be reported
+// even when it is not trusted.
+func checkTLS(ctx context.Context, step *CheckStep, conn net.Conn, host, tlsCA string, insecure bool) (*tls.Conn, error) {
+	cfg, err := newTLSConfig(tlsCA, insecure)
+	if err != nil {
+		return nil, err
+	}
+	roots := cfg.RootCAs
+	cfg.ServerName = host
+	cfg.InsecureSkipVerify = true
+	tlsConn := tls.Client(conn, cfg)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		return nil, err
+	}
+	state := tlsConn.ConnectionState()
+	step.detail("%s, %s", tls.VersionName(state.Version), tls.CipherSuiteName(state.CipherSuite))
+
+	now := time.Now()
+	for i, cert := range state.PeerCertificates {
+		step.detail("certificate %d: subject %q, issuer %q, expires %s", i, cert.Subject, cert.Issuer, cert.NotAfter.UTC().Format(time.RFC3339))
+		if now.After(cert.NotAfter) {
+			step.detail("certificate %d has expired", i)
+		} else if cert.NotAfter.Sub(now) < certExpiryWarning {
+			step.detail("certificate %d expires in %d days", i, int(cert.NotAfter.Sub(now).Hours()/24))
+		}
+	}
+	if len(state.PeerCertificates) == 0 {
+		return tlsConn, fmt.Errorf("server did not present a certificate")
+	}
+
+	leaf := state.PeerCertificates[0]
+	verifyOpts := x509.VerifyOptions{Roots: roots, DNSName: host, Intermediates: x509.NewCertPool()}
+	for _, cert := range state.PeerCertificates[1:] {
+		verifyOpts.Intermediates.AddCert(cert)
+	}
+	if err := leaf.VerifyHostname(host); err != nil {
+		step.detail("hostname does not match: %s", err)
+	} else {
+		step.detail("hostname %s matches", host)
+	}
+	_, err = leaf.Verify(verifyOpts)
+	switch {
+	case err == nil:
+		step.detail("certificate chain verified")
+	case insecure:
+		step.detail("certificate not verified, ignored due to insecure: %s", err)
+		err = nil
+	}
+	return tlsConn, err
+}
+
+func connackDetails(step *CheckStep, props *paho.ConnackProperties) {
+	if props == nil {
+		return
+	}
+	if props.ReasonString != "" {
+		step.detail("reason: %s", props.ReasonString)
+	}
+	if props.AssignedClientID != "" {
+		step.detail("assigned client id: %s", props.AssignedClientID)
+	}
+	if props.MaximumQoS != nil {
+		step.detail("maximum qos: %d", *props.MaximumQoS)
+	} else {
+		step.detail("maximum qos: 2")
+	}
+	if props.TopicAliasMaximum != nil {
+		step.detail("topic alias maximum: %d", *props.TopicAliasMaximum)
+	}
+	if props.MaximumPacketSize != nil {
+		step.detail("maximum packet size: %d", *props.MaximumPacketSize)
+	}
+	if props.ReceiveMaximum != nil {
+		step.detail("receive maximum: %d", *props.ReceiveMaximum)
+	}
+	if props.ServerKeepAlive != nil {
+		step.detail("server keep alive: %ds", *props.ServerKeepAlive)
+	}
+	step.detail("retain available: %t, wildcard subscriptions available: %t, shared subscriptions available: %t",
+		props.RetainAvailable, props.WildcardSubAvailable, props.SharedSubAvailable)
+	if props.ServerReference != "" {
+		step.detail("server reference: %s", props.ServerReference)
+	}
+	for _, p := range props.User {
+		step.detail("user property %s: %s", p.Key, p.Value)
+	}
+}
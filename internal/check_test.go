@@ -0,0 +1,173 @@
+package internal
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eclipse/paho.golang/packets"
+	"github.com/stretchr/testify/require"
+)
+
+// serveFakeBroker accepts connections on l and answers CONNECT with connackCode and
+// PUBLISH with pubackCode.
+func serveFakeBroker(t *testing.T, l net.Listener, connackCode, pubackCode byte) {
+	t.Helper()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				for {
+					pkt, err := packets.ReadPacket(conn)
+					if err != nil {
+						return
+					}
+					switch p := pkt.Content.(type) {
+					case *packets.Connect:
+						maxQoS := byte(1)
+						resp := packets.NewControlPacket(packets.CONNACK)
+						resp.Content.(*packets.Connack).ReasonCode = connackCode
+						resp.Content.(*packets.Connack).Properties = &packets.Properties{MaximumQOS: &maxQoS, ReasonString: "fake"}
+						resp.WriteTo(conn)
+					case *packets.Publish:
+						resp := packets.NewControlPacket(packets.PUBACK)
+						resp.Content.(*packets.Puback).PacketID = p.PacketID
+						resp.Content.(*packets.Puback).ReasonCode = pubackCode
+						resp.WriteTo(conn)
+					case *packets.Disconnect:
+						return
+					}
+				}
+			}()
+		}
+	}()
+}
+
+func selfSignedCert(t *testing.T) (tls.Certificate, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "fake broker"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		DNSNames:              []string{"localhost"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func stepNames(steps []*CheckStep) []string {
+	names := []string{}
+	for _, step := range steps {
+		names = append(names, step.Name)
+	}
+	return names
+}
+
+func TestCheckBroker(t *testing.T) {
+	t.Setenv("WISPUB_BROKER_USER", "user")
+	t.Setenv("WISPUB_BROKER_PASSWD", "passwd")
+	ctx := context.Background()
+
+	t.Run("tcp", func(t *testing.T) {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer l.Close()
+		serveFakeBroker(t, l, 0, 0)
+
+		u, _ := url.Parse("tcp://" + l.Addr().String())
+		steps := CheckBroker(ctx, CheckOptions{Broker: u, ClientID: "test", Topic: "sandbox/test", Timeout: time.Second})
+		require.Equal(t, []string{"dns", "tcp", "mqtt connect", "publish"}, stepNames(steps))
+		for _, step := range steps {
+			require.NoError(t, step.Err, step.Name)
+		}
+		require.Contains(t, steps[2].Details, "maximum qos: 1")
+		require.Contains(t, steps[3].Details, "PUBACK reason code 0: success")
+	})
+
+	t.Run("not authorized", func(t *testing.T) {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer l.Close()
+		serveFakeBroker(t, l, 0, 0x87)
+
+		u, _ := url.Parse("tcp://" + l.Addr().String())
+		steps := CheckBroker(ctx, CheckOptions{Broker: u, ClientID: "test", Topic: "sandbox/test", Timeout: time.Second})
+		require.Len(t, steps, 4)
+		require.Error(t, steps[3].Err)
+		require.Contains(t, steps[3].Details, "PUBACK reason code 135: not authorized")
+	})
+
+	t.Run("connect refused", func(t *testing.T) {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer l.Close()
+		serveFakeBroker(t, l, 0x86, 0)
+
+		u, _ := url.Parse("tcp://" + l.Addr().String())
+		steps := CheckBroker(ctx, CheckOptions{Broker: u, ClientID: "test", Topic: "sandbox/test", Timeout: time.Second})
+		require.Equal(t, []string{"dns", "tcp", "mqtt connect"}, stepNames(steps))
+		require.Error(t, steps[2].Err)
+		require.Contains(t, steps[2].Details, "CONNACK reason code 134")
+		require.Contains(t, steps[2].Details, "reason: fake")
+	})
+
+	t.Run("tls", func(t *testing.T) {
+		cert, certPEM := selfSignedCert(t)
+		l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+		require.NoError(t, err)
+		defer l.Close()
+		serveFakeBroker(t, l, 0, 0)
+		_, port, _ := net.SplitHostPort(l.Addr().String())
+		u, _ := url.Parse("ssl://localhost:" + port)
+
+		// not trusted
+		steps := CheckBroker(ctx, CheckOptions{Broker: u, ClientID: "test", Timeout: time.Second})
+		require.Equal(t, []string{"dns", "tcp", "tls"}, stepNames(steps))
+		require.Error(t, steps[2].Err)
+		require.Contains(t, strings.Join(steps[2].Details, "\n"), `subject "CN=fake broker"`)
+		require.Contains(t, steps[2].Details, "certificate 0 expires in 0 days")
+
+		steps = CheckBroker(ctx, CheckOptions{Broker: u, ClientID: "test", Insecure: true, Timeout: time.Second})
+		require.Equal(t, []string{"dns", "tcp", "tls", "mqtt connect"}, stepNames(steps))
+		require.NoError(t, steps[3].Err)
+
+		ca := filepath.Join(t.TempDir(), "ca.pem")
+		require.NoError(t, os.WriteFile(ca, certPEM, 0o644))
+		steps = CheckBroker(ctx, CheckOptions{Broker: u, ClientID: "test", TLSCA: ca, Timeout: time.Second})
+		require.Len(t, steps, 4)
+		require.NoError(t, steps[2].Err)
+		require.Contains(t, steps[2].Details, "hostname localhost matches")
+		require.Contains(t, steps[2].Details, "certificate chain verified")
+	})
+
+	t.Run("unsupported scheme", func(t *testing.T) {
+		u, _ := url.Parse("ws://localhost")
+		steps := CheckBroker(ctx, CheckOptions{Broker: u})
+		require.Len(t, steps, 1)
+		require.Error(t, steps[0].Err)
+	})
+}
@@ -0,0 +1,58 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DefaultPubTimePrecision is the precision of notification pubtimes unless configured
+// otherwise
+const DefaultPubTimePrecision = time.Millisecond
+
+// Clock returns the current time. It is used for notification pubtimes so the time can
+// be controlled, e.g., to make messages deterministic in tests.
+type Clock func() time.Time
+
+// SystemClock is the Clock using the system time
+func SystemClock() time.Time { return time.Now() }
+
+// FixedClock returns a Clock that always returns t
+func FixedClock(t time.Time) Clock {
+	return func() time.Time { return t }
+}
+
+// pubTimePrecisions are the supported precisions by name
+var pubTimePrecisions = map[string]time.Duration{
+	"s":  time.Second,
+	"ms": time.Millisecond,
+	"us": time.Microsecond,
+	"ns": time.Nanosecond,
+}
+
+// ParsePubTimePrecision parses a pubtime precision of s, ms, us or ns
+func ParsePubTimePrecision(s string) (time.Duration, error) {
+	precision, ok := pubTimePrecisions[strings.ToLower(strings.TrimSpace(s))]
+	if !ok {
+		return 0, fmt.Errorf("invalid pubtime precision %q, expected one of s, ms, us or ns", s)
+	}
+	return precision, nil
+}
+
+// FormatPubTime formats t as an RFC3339 UTC timestamp truncated to precision, with the
+// number of fractional second digits given by the precision, e.g., 3 for
+// time.Millisecond. A precision of 0 is DefaultPubTimePrecision.
+func FormatPubTime(t time.Time, precision time.Duration) string {
+	if precision <= 0 {
+		precision = DefaultPubTimePrecision
+	}
+	layout := "2006-01-02T15:04:05"
+	if precision < time.Second {
+		digits := 0
+		for p := precision; p < time.Second; p *= 10 {
+			digits++
+		}
+		layout += "." + strings.Repeat("0", digits)
+	}
+	return t.UTC().Truncate(precision).Format(layout + "Z")
+}
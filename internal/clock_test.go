@@ -0,0 +1,59 @@
+package internal
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatPubTime(t *testing.T) {
+	// a non-UTC time to check the offset is applied
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 123456789, time.FixedZone("CST", -6*3600))
+	cases := []struct {
+		precision time.Duration
+		expected  string
+	}{
+		{0, "2024-01-02T09:04:05.123Z"},
+		{time.Second, "2024-01-02T09:04:05Z"},
+		{time.Millisecond, "2024-01-02T09:04:05.123Z"},
+		{time.Microsecond, "2024-01-02T09:04:05.123456Z"},
+		{time.Nanosecond, "2024-01-02T09:04:05.123456789Z"},
+	}
+	for _, test := range cases {
+		require.Equal(t, test.expected, FormatPubTime(ts, test.precision), test.precision)
+	}
+
+	precision, err := ParsePubTimePrecision("US")
+	require.NoError(t, err)
+	require.Equal(t, time.Microsecond, precision)
+	_, err = ParsePubTimePrecision("minutes")
+	require.Error(t, err)
+}
+
+func TestNewNotificationMessagePubTime(t *testing.T) {
+	fpath := filepath.Join(t.TempDir(), "granule.dat")
+	require.NoError(t, os.WriteFile(fpath, []byte("xxx"), 0o644))
+	in, err := NewInput(fpath, InputConfig{})
+	require.NoError(t, err)
+
+	downloadURL, _ := url.Parse("https://server/granule.dat")
+	opts := NotificationOptions{
+		Topic:       "origin/a/wis2/centre/data/core/weather",
+		DownloadURL: downloadURL,
+		Clock:       FixedClock(time.Date(2024, 1, 2, 3, 4, 5, 0, time.FixedZone("", 3600))),
+	}
+	msg, err := NewNotificationMessage(context.Background(), in, opts)
+	require.NoError(t, err)
+	require.Equal(t, "2024-01-02T02:04:05.000Z", msg.Properties.PubTime)
+
+	opts.PubTime = time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)
+	opts.PubTimePrecision = time.Second
+	msg, err = NewNotificationMessage(context.Background(), in, opts)
+	require.NoError(t, err)
+	require.Equal(t, "2023-06-01T00:00:00Z", msg.Properties.PubTime)
+}
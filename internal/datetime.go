@@ -0,0 +1,180 @@
+package internal
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// openDatetime is the start or end of an open-ended interval, which notifications
+// cannot have
+const openDatetime = ".."
+
+// timestampLayouts are the layouts accepted for timestamps. Values without a zone are
+// UTC.
+var timestampLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+	"20060102T150405Z0700",
+	"20060102T150405Z",
+	"2006-01-02",
+	"20060102",
+}
+
+var (
+	epochRegexp    = regexp.MustCompile(`^@\d+(\.\d+)?$`)
+	digitsRegexp   = regexp.MustCompile(`^\d+(\.\d+)?$`)
+	durationRegexp = regexp.MustCompile(`^P(?:(\d+)Y)?(?:(\d+)M)?(?:(\d+)W)?(?:(\d+)D)?(?:T(?:(\d+(?:\.\d+)?)H)?(?:(\d+(?:\.\d+)?)M)?(?:(\d+(?:\.\d+)?)S)?)?$`)
+)
+
+// ParseTimestamp parses an RFC3339 or similar timestamp, a date, or Unix epoch seconds
+// prefixed with @, e.g., @1704164645, returning the time in UTC. Timestamps without a
+// zone are UTC.
+func ParseTimestamp(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if epochRegexp.MatchString(s) {
+		secs, frac, _ := strings.Cut(s[1:], ".")
+		sec, err := strconv.ParseInt(secs, 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid epoch seconds: %q", s)
+		}
+		nsec := int64(0)
+		if frac != "" {
+			frac = (frac + "000000000")[:9]
+			nsec, _ = strconv.ParseInt(frac, 10, 64)
+		}
+		return time.Unix(sec, nsec).UTC(), nil
+	}
+	for _, layout := range timestampLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	if digitsRegexp.MatchString(s) {
+		return time.Time{}, fmt.Errorf("unrecognized time format: %q, Unix epoch seconds must be prefixed with @, e.g., @%s", s, s)
+	}
+	return time.Time{}, fmt.Errorf("unrecognized time format: %q", s)
+}
+
+// isoDuration is an ISO 8601 duration. The date part is kept separate because the
+// length of years, months and days depends on the time it is applied to.
+type isoDuration struct {
+	years, months, days int
+	clock               time.Duration
+}
+
+func parseISODuration(s string) (isoDuration, error) {
+	m := durationRegexp.FindStringSubmatch(s)
+	if m == nil || s == "P" || strings.HasSuffix(s, "T") {
+		return isoDuration{}, fmt.Errorf("invalid duration: %q", s)
+	}
+	d := isoDuration{}
+	d.years, _ = strconv.Atoi(m[1])
+	d.months, _ = strconv.Atoi(m[2])
+	weeks, _ := strconv.Atoi(m[3])
+	d.days, _ = strconv.Atoi(m[4])
+	d.days += 7 * weeks
+	for i, unit := range []time.Duration{time.Hour, time.Minute, time.Second} {
+		if m[5+i] == "" {
+			continue
+		}
+		v, _ := strconv.ParseFloat(m[5+i], 64)
+		d.clock += time.Duration(math.Round(v * float64(unit)))
+	}
+	return d, nil
+}
+
+func (d isoDuration) addTo(t time.Time, sign int) time.Time {
+	return t.AddDate(sign*d.years, sign*d.months, sign*d.days).Add(time.Duration(sign) * d.clock)
+}
+
+// FormatDatetime formats a notification datetime in UTC, truncated to precision, e.g.,
+// time.Second for whole seconds. If precision is 0 any fractional seconds are kept.
+func FormatDatetime(t time.Time, precision time.Duration) string {
+	if precision > 0 {
+		t = t.Truncate(precision)
+	}
+	return t.UTC().Format("2006-01-02T15:04:05.999999999Z")
+}
+
+// ParseDatetime parses the datetime of data, returning the start and end. If end is
+// empty start is a single datetime. The value can be:
+//
+//   - a single timestamp, e.g., 2024-01-02T03:04:05.5+01:00, 2024-01-02, or Unix epoch
+//     seconds prefixed with @
+//   - an ISO 8601 interval of <start>/<end>, <start>/<duration> or <duration>/<end>, e.g.,
+//     2024-01-02T03:00:00Z/PT10M
+//   - a comma separated start and end
+//
+// Timestamps without a zone are UTC, and all values are converted to UTC with
+// fractional seconds kept. Date only values are the start of the day. An error is
+// returned for open-ended intervals, which notifications cannot have, if the start is
+// after the end, and intervals with the same start and end are a single datetime.
+func ParseDatetime(value string) (string, string, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "", "", nil
+	}
+	startStr, endStr, found := strings.Cut(value, "/")
+	if !found {
+		startStr, endStr, found = strings.Cut(value, ",")
+	}
+	if !found {
+		t, err := ParseTimestamp(value)
+		if err != nil {
+			return "", "", fmt.Errorf("invalid datetime value: %w", err)
+		}
+		return FormatDatetime(t, 0), "", nil
+	}
+	startStr, endStr = strings.TrimSpace(startStr), strings.TrimSpace(endStr)
+
+	var start, end time.Time
+	var startDur, endDur *isoDuration
+	for _, v := range []struct {
+		s   string
+		t   *time.Time
+		dur **isoDuration
+	}{{startStr, &start, &startDur}, {endStr, &end, &endDur}} {
+		switch {
+		case v.s == openDatetime:
+			return "", "", fmt.Errorf("invalid datetime interval %q, open-ended intervals are not supported, "+
+				"give the start and end, or a start and duration, e.g., 2024-01-02T03:00:00Z/PT1H", value)
+		case strings.HasPrefix(v.s, "P"):
+			d, err := parseISODuration(v.s)
+			if err != nil {
+				return "", "", err
+			}
+			*v.dur = &d
+		default:
+			t, err := ParseTimestamp(v.s)
+			if err != nil {
+				return "", "", fmt.Errorf("invalid datetime value: %w", err)
+			}
+			*v.t = t
+		}
+	}
+
+	switch {
+	case startDur != nil && endDur != nil:
+		return "", "", fmt.Errorf("invalid datetime interval %q, only one of start and end may be a duration", value)
+	case startDur != nil:
+		start = startDur.addTo(end, -1)
+	case endDur != nil:
+		end = endDur.addTo(start, 1)
+	}
+
+	switch {
+	case start.After(end):
+		return "", "", fmt.Errorf("invalid datetime interval %q, the start is after the end", value)
+	case start.Equal(end):
+		return FormatDatetime(start, 0), "", nil
+	}
+	return FormatDatetime(start, 0), FormatDatetime(end, 0), nil
+}
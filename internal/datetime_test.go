@@ -0,0 +1,69 @@
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDatetime(t *testing.T) {
+	cases := []struct {
+		value      string
+		start, end string
+	}{
+		{"", "", ""},
+		{"2024-01-02T03:04:05Z", "2024-01-02T03:04:05Z", ""},
+		{"2024-01-02T03:04:05.123456Z", "2024-01-02T03:04:05.123456Z", ""},
+		{"2024-01-02T03:04:05+05:30", "2024-01-01T21:34:05Z", ""},
+		{"2024-01-02T03:04:05", "2024-01-02T03:04:05Z", ""},
+		{"2024-01-02", "2024-01-02T00:00:00Z", ""},
+		{"20240102", "2024-01-02T00:00:00Z", ""},
+		{"@1704164645", "2024-01-02T03:04:05Z", ""},
+		{"@1704164645.25", "2024-01-02T03:04:05.25Z", ""},
+		{"2024-01-02T03:00:00Z,2024-01-02T04:00:00Z", "2024-01-02T03:00:00Z", "2024-01-02T04:00:00Z"},
+		{"2024-01-02T03:00:00Z/2024-01-02T04:00:00-01:00", "2024-01-02T03:00:00Z", "2024-01-02T05:00:00Z"},
+		{"2024-01-02T03:00:00Z/PT10M", "2024-01-02T03:00:00Z", "2024-01-02T03:10:00Z"},
+		{"2024-01-31/P1M", "2024-01-31T00:00:00Z", "2024-03-02T00:00:00Z"},
+		{"2024-01-02T03:00:00Z/PT0.5S", "2024-01-02T03:00:00Z", "2024-01-02T03:00:00.5Z"},
+		{"P1DT1H/2024-01-02T03:00:00Z", "2024-01-01T02:00:00Z", "2024-01-02T03:00:00Z"},
+		{"P1W/2024-01-08", "2024-01-01T00:00:00Z", "2024-01-08T00:00:00Z"},
+		{"2024-01-02T03:00:00Z/2024-01-02T03:00:00Z", "2024-01-02T03:00:00Z", ""},
+	}
+	for _, test := range cases {
+		start, end, err := ParseDatetime(test.value)
+		require.NoError(t, err, test.value)
+		require.Equal(t, test.start, start, test.value)
+		require.Equal(t, test.end, end, test.value)
+	}
+
+	for _, value := range []string{
+		"yesterday",
+		"2024-13-02",
+		"2024-01-02T04:00:00Z/2024-01-02T03:00:00Z",
+		"1704164645",
+		"2024-01-02T03:00:00Z/..",
+		"../2024-01-02T03:00:00Z",
+		"../..",
+		"PT1H/PT2H",
+		"PT1H/..",
+		"2024-01-02T03:00:00Z/P",
+		"2024-01-02T03:00:00Z/PT",
+		"2024-01-02T03:00:00Z/P1H",
+	} {
+		_, _, err := ParseDatetime(value)
+		require.Error(t, err, value)
+	}
+	// errors point to the supported syntax
+	_, _, err := ParseDatetime("1704164645")
+	require.ErrorContains(t, err, "@1704164645")
+	_, _, err = ParseDatetime("2024-01-02T03:00:00Z/..")
+	require.ErrorContains(t, err, "start and duration")
+}
+
+func TestFormatDatetime(t *testing.T) {
+	tm := time.Date(2024, 1, 2, 3, 4, 5, 123456000, time.FixedZone("", 3600))
+	require.Equal(t, "2024-01-02T02:04:05.123456Z", FormatDatetime(tm, 0))
+	require.Equal(t, "2024-01-02T02:04:05.123Z", FormatDatetime(tm, time.Millisecond))
+	require.Equal(t, "2024-01-02T02:04:05Z", FormatDatetime(tm, time.Second))
+}
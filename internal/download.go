@@ -0,0 +1,135 @@
+package internal
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"time"
+)
+
+// CanonicalLink returns the canonical link of a notification message and the integrity
+// of the data it refers to, i.e., the link integrity if set, otherwise
+// properties.integrity.
+func CanonicalLink(msg *NotificationMsgV04) (*Link, *Integrity, error) {
+	for i, link := range msg.Links {
+		if link.Rel != "canonical" {
+			continue
+		}
+		integrity := link.Integrity
+		if integrity == nil && msg.Properties.Integrity.Method != "" {
+			integrity = &msg.Properties.Integrity
+		}
+		return &msg.Links[i], integrity, nil
+	}
+	return nil, nil, fmt.Errorf("no canonical link")
+}
+
+// Downloader downloads notification data to a local directory.
+type Downloader struct {
+	// Dir is the directory files are written to
+	Dir string
+	// Client is used for requests. http.DefaultClient is used if nil.
+	Client *http.Client
+	// Attempts is the number of times a download is attempted before giving up. A
+	// download is attempted once if <= 1.
+	Attempts int
+	// RetryWait is the wait before retrying a failed download, doubling for each
+	// subsequent attempt
+	RetryWait time.Duration
+}
+
+// Download downloads href to relpath, relative to Dir, retrying failed attempts. The
+// content must be length bytes, if length > 0, and match integrity, if not nil. Files are
+// written to a temporary file and renamed when verified, so a partial or corrupt file is
+// never left in Dir. It returns the number of bytes written.
+func (d *Downloader) Download(ctx context.Context, href string, length int64, integrity *Integrity, relpath string) (int64, error) {
+	wait := d.RetryWait
+	for attempt := 1; ; attempt++ {
+		size, err := d.download(ctx, href, length, integrity, relpath)
+		if err == nil || attempt >= d.Attempts || ctx.Err() != nil {
+			if err != nil && attempt > 1 {
+				err = fmt.Errorf("after %d attempts: %w", attempt, err)
+			}
+			return size, err
+		}
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return 0, fmt.Errorf("after %d attempts: %w", attempt, err)
+		}
+		wait *= 2
+	}
+}
+
+func (d *Downloader) download(ctx context.Context, href string, length int64, integrity *Integrity, relpath string) (int64, error) {
+	client := d.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, href, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	r := &verifyingReader{r: resp.Body, length: length}
+	if integrity != nil {
+		r.integrity = integrity
+		if r.hash, err = newHash(integrity.Method); err != nil {
+			return 0, err
+		}
+	}
+	stager := &dirStager{root: d.Dir}
+	return stager.Stage(ctx, r, length, relpath)
+}
+
+var errDownloadMismatch = errors.New("downloaded content does not match the notification")
+
+// verifyingReader returns an error instead of io.EOF if the content read does not have
+// the expected length and integrity, so the file being written is discarded.
+type verifyingReader struct {
+	r         io.Reader
+	length    int64
+	integrity *Integrity
+	hash      hash.Hash
+	n         int64
+}
+
+func (v *verifyingReader) Read(p []byte) (int, error) {
+	n, err := v.r.Read(p)
+	v.n += int64(n)
+	if v.hash != nil {
+		v.hash.Write(p[:n])
+	}
+	if err != io.EOF {
+		return n, err
+	}
+	if v.length > 0 && v.n != v.length {
+		return n, fmt.Errorf("%w: length %d, expected %d", errDownloadMismatch, v.n, v.length)
+	}
+	if v.hash != nil && base64.StdEncoding.EncodeToString(v.hash.Sum(nil)) != v.integrity.Value {
+		return n, fmt.Errorf("%w: %s checksum", errDownloadMismatch, v.integrity.Method)
+	}
+	return n, io.EOF
+}
+
+// DecodeNotification decodes a notification message, e.g., as received from a broker.
+func DecodeNotification(dat []byte) (*NotificationMsgV04, error) {
+	msg := &NotificationMsgV04{}
+	if err := json.Unmarshal(dat, msg); err != nil {
+		return nil, fmt.Errorf("decoding notification: %w", err)
+	}
+	return msg, nil
+}
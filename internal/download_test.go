@@ -0,0 +1,109 @@
+package internal
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCanonicalLink(t *testing.T) {
+	msg, err := DecodeNotification([]byte(`{
+		"properties": {"integrity": {"method": "sha512", "value": "xxx"}},
+		"links": [
+			{"href": "https://server/other.png", "rel": "preview"},
+			{"href": "https://server/granule.nc", "rel": "canonical", "length": 3}
+		]
+	}`))
+	require.NoError(t, err)
+	link, integrity, err := CanonicalLink(msg)
+	require.NoError(t, err)
+	require.Equal(t, "https://server/granule.nc", link.Href)
+	require.Equal(t, int64(3), link.Length)
+	require.Equal(t, &Integrity{Method: "sha512", Value: "xxx"}, integrity)
+
+	msg.Links = msg.Links[:1]
+	_, _, err = CanonicalLink(msg)
+	require.Error(t, err)
+}
+
+func TestDownloader(t *testing.T) {
+	content := []byte("some served content")
+	integrity := &Integrity{Method: "sha512", Value: sha512b64(content)}
+	size := int64(len(content))
+
+	var flaky atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/file":
+			w.Write(content)
+		case "/flaky":
+			if flaky.Add(1) < 3 {
+				http.Error(w, "not yet", http.StatusServiceUnavailable)
+				return
+			}
+			w.Write(content)
+		case "/changed":
+			w.Write([]byte(strings.ToUpper(string(content))))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	dir := t.TempDir()
+	d := &Downloader{Dir: dir, Attempts: 3, RetryWait: time.Millisecond}
+
+	t.Run("ok", func(t *testing.T) {
+		n, err := d.Download(ctx, srv.URL+"/file", size, integrity, "a/b/file.nc")
+		require.NoError(t, err)
+		require.Equal(t, size, n)
+		dat, err := os.ReadFile(filepath.Join(dir, "a", "b", "file.nc"))
+		require.NoError(t, err)
+		require.Equal(t, content, dat)
+	})
+
+	t.Run("retried", func(t *testing.T) {
+		_, err := d.Download(ctx, srv.URL+"/flaky", 0, nil, "flaky.nc")
+		require.NoError(t, err)
+		require.Equal(t, int32(3), flaky.Load())
+	})
+
+	t.Run("wrong length", func(t *testing.T) {
+		_, err := d.Download(ctx, srv.URL+"/file", size+1, nil, "length.nc")
+		require.ErrorIs(t, err, errDownloadMismatch)
+		require.Contains(t, err.Error(), "after 3 attempts")
+		require.NoFileExists(t, filepath.Join(dir, "length.nc"))
+	})
+
+	t.Run("wrong checksum", func(t *testing.T) {
+		_, err := d.Download(ctx, srv.URL+"/changed", size, integrity, "changed.nc")
+		require.ErrorIs(t, err, errDownloadMismatch)
+		require.NoFileExists(t, filepath.Join(dir, "changed.nc"))
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		for _, e := range entries {
+			require.False(t, strings.HasPrefix(e.Name(), "."), "temporary file left: %s", e.Name())
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		_, err := d.Download(ctx, srv.URL+"/missing", size, nil, "missing.nc")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "404")
+	})
+
+	t.Run("escaping path", func(t *testing.T) {
+		_, err := d.Download(ctx, srv.URL+"/file", size, nil, "../../outside.nc")
+		require.NoError(t, err)
+		require.FileExists(t, filepath.Join(dir, "outside.nc"))
+	})
+}
@@ -3,13 +3,36 @@ package internal
 import (
 	"encoding/json"
 	"fmt"
+	"os"
+	"sort"
+	"strings"
 )
 
+// specProperties are the notification properties defined by the WIS2 Notification
+// Message specification
+var specProperties = map[string]bool{
+	"data_id":                  true,
+	"metadata_id":              true,
+	"producer":                 true,
+	"pubtime":                  true,
+	"datetime":                 true,
+	"start_datetime":           true,
+	"end_datetime":             true,
+	"integrity":                true,
+	"content":                  true,
+	"cache":                    true,
+	"wigos_station_identifier": true,
+	"gts":                      true,
+}
+
 func Encode(msg any) ([]byte, error) {
 	return json.MarshalIndent(msg, "", "  ")
 }
 
-func EncodeMessage(msg any, properties map[string]any) ([]byte, error) {
+// EncodeMessage encodes msg with properties merged into its properties. An error is
+// returned if properties would overwrite a property set in msg or defined by the
+// specification, unless force is true.
+func EncodeMessage(msg any, properties map[string]any, force bool) ([]byte, error) {
 	dat, err := Encode(msg)
 	if err != nil {
 		return nil, err
@@ -27,6 +50,19 @@ func EncodeMessage(msg any, properties map[string]any) ([]byte, error) {
 		return nil, fmt.Errorf("redecoding properties: %w", err)
 	}
 
+	if !force {
+		conflicts := []string{}
+		for k := range properties {
+			if _, ok := existing[k]; ok || specProperties[k] {
+				conflicts = append(conflicts, k)
+			}
+		}
+		if len(conflicts) > 0 {
+			sort.Strings(conflicts)
+			return nil, fmt.Errorf("properties defined by the message cannot be overwritten: %s", strings.Join(conflicts, ", "))
+		}
+	}
+
 	for k, v := range properties {
 		existing[k] = v
 	}
@@ -37,3 +73,56 @@ func EncodeMessage(msg any, properties map[string]any) ([]byte, error) {
 
 	return json.MarshalIndent(raw, "", "  ")
 }
+
+// RewriteMessage replaces the id, if id is set, and properties.pubtime, if pubTime is
+// set, of an encoded notification message, e.g., one generated by another system.
+func RewriteMessage(dat []byte, id, pubTime string) ([]byte, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(dat, &raw); err != nil {
+		return nil, fmt.Errorf("decoding message: %w", err)
+	}
+	var err error
+	if id != "" {
+		raw["id"], _ = json.Marshal(id)
+	}
+	if pubTime != "" {
+		var props map[string]json.RawMessage
+		if err := json.Unmarshal(raw["properties"], &props); err != nil || props == nil {
+			return nil, fmt.Errorf("decoding message properties: expected an object")
+		}
+		props["pubtime"], _ = json.Marshal(pubTime)
+		raw["properties"], err = json.MarshalIndent(props, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("reencoding properties: %w", err)
+		}
+	}
+	return json.MarshalIndent(raw, "", "  ")
+}
+
+// ParseProperty parses a property as <key>=<value>. The value is decoded as JSON if it
+// is valid JSON, e.g., 1, true, or {"a": 1}, otherwise it is a string.
+func ParseProperty(s string) (string, any, error) {
+	key, value, found := strings.Cut(s, "=")
+	key = strings.TrimSpace(key)
+	if !found || key == "" {
+		return "", nil, fmt.Errorf("invalid property %q, expected <key>=<value>", s)
+	}
+	var v any
+	if err := json.Unmarshal([]byte(value), &v); err != nil {
+		return key, value, nil
+	}
+	return key, v, nil
+}
+
+// LoadProperties loads properties from a file containing a JSON object
+func LoadProperties(fpath string) (map[string]any, error) {
+	dat, err := os.ReadFile(fpath)
+	if err != nil {
+		return nil, err
+	}
+	properties := map[string]any{}
+	if err := json.Unmarshal(dat, &properties); err != nil {
+		return nil, fmt.Errorf("decoding properties %s: %w", fpath, err)
+	}
+	return properties, nil
+}
@@ -1,6 +1,8 @@
 package internal
 
 import (
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -30,7 +32,7 @@ func Test_encodeWithAdditionalProperties(t *testing.T) {
 		"myNewProperty":     true,
 		"myOtherProperty":   0,
 		"myAnotherProperty": "XXX",
-	})
+	}, false)
 	require.NoError(t, err)
 
 	replace := strings.NewReplacer(" ", "", "\n", "")
@@ -61,6 +63,64 @@ func Test_encodeWithAdditionalProperties(t *testing.T) {
 	require.Equal(t, expected, replace.Replace(string(dat)))
 }
 
+func Test_encodePropertyConflicts(t *testing.T) {
+	msg := &NotificationMsgV04{
+		Properties: NotificationMsgV04Properties{DataID: "DATAID", PubTime: "PUBTIME"},
+	}
+
+	_, err := EncodeMessage(msg, map[string]any{"data_id": "other", "ok": 1}, false)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "data_id")
+	// spec defined but not set in the message
+	_, err = EncodeMessage(msg, map[string]any{"cache": false}, false)
+	require.Error(t, err)
+
+	dat, err := EncodeMessage(msg, map[string]any{"data_id": "other", "cache": false}, true)
+	require.NoError(t, err)
+	require.Contains(t, string(dat), `"data_id": "other"`)
+	require.Contains(t, string(dat), `"cache": false`)
+}
+
+func TestParseProperty(t *testing.T) {
+	cases := []struct {
+		value string
+		key   string
+		val   any
+	}{
+		{"dataDomain=DBNet", "dataDomain", "DBNet"},
+		{"count=3", "count", float64(3)},
+		{"flag=true", "flag", true},
+		{"code=0123", "code", "0123"},
+		{`code="0123"`, "code", "0123"},
+		{`obj={"a": [1]}`, "obj", map[string]any{"a": []any{float64(1)}}},
+		{"expr=a=b", "expr", "a=b"},
+		{"empty=", "empty", ""},
+	}
+	for _, test := range cases {
+		key, val, err := ParseProperty(test.value)
+		require.NoError(t, err, test.value)
+		require.Equal(t, test.key, key, test.value)
+		require.Equal(t, test.val, val, test.value)
+	}
+	for _, value := range []string{"novalue", "=value"} {
+		_, _, err := ParseProperty(value)
+		require.Error(t, err, value)
+	}
+}
+
+func TestLoadProperties(t *testing.T) {
+	dir := t.TempDir()
+	fpath := filepath.Join(dir, "props.json")
+	require.NoError(t, os.WriteFile(fpath, []byte(`{"dataDomain": "DBNet", "count": 3}`), 0o644))
+	props, err := LoadProperties(fpath)
+	require.NoError(t, err)
+	require.Equal(t, map[string]any{"dataDomain": "DBNet", "count": float64(3)}, props)
+
+	require.NoError(t, os.WriteFile(fpath, []byte(`[1, 2]`), 0o644))
+	_, err = LoadProperties(fpath)
+	require.Error(t, err)
+}
+
 func Test_encodeDatetimes(t *testing.T) {
 	msg := &NotificationMsgV04{
 		ID:         "ID",
@@ -82,16 +142,33 @@ func Test_encodeDatetimes(t *testing.T) {
 
 	t.Run("with", func(t *testing.T) {
 		msg.Properties.Datetime = "xxx"
-		dat, err := EncodeMessage(msg, nil)
+		dat, err := EncodeMessage(msg, nil, false)
 		require.NoError(t, err)
 
 		require.Contains(t, string(dat), "datetime")
 	})
 	t.Run("without", func(t *testing.T) {
 		msg.Properties.Datetime = ""
-		dat, err := EncodeMessage(msg, nil)
+		dat, err := EncodeMessage(msg, nil, false)
 		require.NoError(t, err)
 
 		require.NotContains(t, string(dat), "datetime")
 	})
 }
+
+func TestRewriteMessage(t *testing.T) {
+	orig := []byte(`{"id": "old", "type": "Feature", "properties": {"data_id": "x", "pubtime": "2024-01-01T00:00:00Z", "extra": [1]}, "links": []}`)
+
+	dat, err := RewriteMessage(orig, "new", "2024-02-02T00:00:00.000Z")
+	require.NoError(t, err)
+	require.JSONEq(t, `{"id": "new", "type": "Feature", "properties": {"data_id": "x", "pubtime": "2024-02-02T00:00:00.000Z", "extra": [1]}, "links": []}`, string(dat))
+
+	dat, err = RewriteMessage(orig, "", "")
+	require.NoError(t, err)
+	require.JSONEq(t, string(orig), string(dat))
+
+	_, err = RewriteMessage([]byte(`{"id": "old"}`), "", "2024-02-02T00:00:00.000Z")
+	require.Error(t, err)
+	_, err = RewriteMessage([]byte(`[]`), "new", "")
+	require.Error(t, err)
+}
@@ -0,0 +1,115 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+)
+
+const (
+	ExtractNone   = "none"
+	ExtractAuto   = "auto"
+	ExtractNetCDF = "netcdf"
+	ExtractBUFR   = "bufr"
+	ExtractGRIB2  = "grib2"
+)
+
+// Extracted are notification values extracted from the content of a product file.
+// Empty values were not available.
+type Extracted struct {
+	Geometry *Geometry
+	// Start and End datetimes. If only Start is set it is the datetime of the data.
+	Start, End string
+	// WigosID is the WIGOS station identifier of the observations
+	WigosID string
+}
+
+// Extractor extracts notification values from the content of a product file at a local
+// path.
+type Extractor func(fpath string) (*Extracted, error)
+
+// NewExtractor returns the extractor for a kind of product, one of the Extract*
+// constants. For ExtractAuto the extractor is chosen using the input mime type, and nil
+// is returned if there is no extractor for the type. nil is also returned for
+// ExtractNone.
+//
+// As ExtractAuto is a best effort, the extractor it returns does not fail when the
+// content cannot be extracted from. GRIB1 files are skipped, and other errors are logged
+// as warnings, with no values extracted.
+func NewExtractor(kind, mimeType string) (Extractor, error) {
+	if kind == ExtractAuto {
+		switch baseMimeType(mimeType) {
+		case "application/x-netcdf", "application/netcdf", "application/x-netcdf4", "application/x-hdf5":
+			kind = ExtractNetCDF
+		case "application/bufr", "application/x-bufr":
+			kind = ExtractBUFR
+		case "application/grib", "application/x-grib", "application/x-grib2":
+			kind = ExtractGRIB2
+		default:
+			return nil, nil
+		}
+		extractor, err := NewExtractor(kind, mimeType)
+		if err != nil {
+			return nil, err
+		}
+		return autoExtractor(kind, extractor), nil
+	}
+	switch kind {
+	case ExtractNone, "":
+		return nil, nil
+	case ExtractNetCDF:
+		return ExtractNetCDFAttrs, nil
+	case ExtractBUFR:
+		return ExtractBUFRObs, nil
+	case ExtractGRIB2:
+		return ExtractGRIB2Fields, nil
+	}
+	return nil, fmt.Errorf("unsupported extractor: %s", kind)
+}
+
+// autoExtractor wraps the kind extractor chosen by ExtractAuto so content it cannot
+// extract from does not prevent publishing.
+func autoExtractor(kind string, extractor Extractor) Extractor {
+	return func(fpath string) (*Extracted, error) {
+		zult, err := extractor(fpath)
+		switch {
+		case errors.Is(err, errGRIBEdition):
+			slog.Debug("not extracting from grib file", "extractor", kind, "error", err)
+			return &Extracted{}, nil
+		case err != nil:
+			slog.Warn("failed to extract from input, continuing without extracted values", "extractor", kind, "error", err)
+			return &Extracted{}, nil
+		}
+		return zult, nil
+	}
+}
+
+// extract runs extractor on the content of input, downloading remote inputs to a
+// temporary file first.
+func extract(ctx context.Context, input Input, extractor Extractor) (*Extracted, error) {
+	if fi, ok := input.(*fileInput); ok {
+		return extractor(fi.path)
+	}
+
+	r, err := input.Open(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	f, err := os.CreateTemp("", "wispub-*-"+input.Name())
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	if _, err := io.Copy(f, r); err != nil {
+		return nil, fmt.Errorf("downloading input: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+	return extractor(f.Name())
+}
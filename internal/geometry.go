@@ -0,0 +1,296 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	GeometryPoint        = "Point"
+	GeometryPolygon      = "Polygon"
+	GeometryMultiPolygon = "MultiPolygon"
+)
+
+// Position is a GeoJSON position, i.e., longitude, latitude and optional altitude.
+type Position []float64
+
+// Ring is a closed linear ring of positions.
+type Ring []Position
+
+// Geometry is a GeoJSON (RFC 7946) Point, Polygon or MultiPolygon geometry.
+type Geometry struct {
+	Type string
+	// Point is set for Point geometries
+	Point Position
+	// Polygon is set for Polygon geometries. The first ring is the exterior ring and any
+	// others are holes.
+	Polygon []Ring
+	// MultiPolygon is set for MultiPolygon geometries
+	MultiPolygon [][]Ring
+}
+
+type rawGeometry struct {
+	Type        string          `json:"type"`
+	Coordinates json.RawMessage `json:"coordinates"`
+}
+
+func (g Geometry) MarshalJSON() ([]byte, error) {
+	var coords any
+	switch g.Type {
+	case GeometryPoint:
+		coords = g.Point
+	case GeometryPolygon:
+		coords = g.Polygon
+	case GeometryMultiPolygon:
+		coords = g.MultiPolygon
+	default:
+		return nil, fmt.Errorf("unsupported geometry type: %q", g.Type)
+	}
+	return json.Marshal(struct {
+		Type        string `json:"type"`
+		Coordinates any    `json:"coordinates"`
+	}{g.Type, coords})
+}
+
+func (g *Geometry) UnmarshalJSON(dat []byte) error {
+	raw := rawGeometry{}
+	if err := json.Unmarshal(dat, &raw); err != nil {
+		return err
+	}
+	*g = Geometry{Type: raw.Type}
+	var err error
+	switch raw.Type {
+	case GeometryPoint:
+		err = json.Unmarshal(raw.Coordinates, &g.Point)
+	case GeometryPolygon:
+		err = json.Unmarshal(raw.Coordinates, &g.Polygon)
+	case GeometryMultiPolygon:
+		err = json.Unmarshal(raw.Coordinates, &g.MultiPolygon)
+	default:
+		return fmt.Errorf("unsupported geometry type: %q", raw.Type)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid %s coordinates: %w", raw.Type, err)
+	}
+	return nil
+}
+
+// NewPoint returns a Point geometry. Altitude is optional.
+func NewPoint(lon, lat float64, alt ...float64) *Geometry {
+	pos := Position{lon, lat}
+	if len(alt) > 0 {
+		pos = append(pos, alt[0])
+	}
+	return &Geometry{Type: GeometryPoint, Point: pos}
+}
+
+// NewBBox returns a Polygon geometry for a bounding box. If west is greater than east
+// the box crosses the antimeridian and is split into a MultiPolygon.
+func NewBBox(west, south, east, north float64) *Geometry {
+	if west > east {
+		return &Geometry{Type: GeometryMultiPolygon, MultiPolygon: [][]Ring{
+			{bboxRing(west, south, 180, north)},
+			{bboxRing(-180, south, east, north)},
+		}}
+	}
+	return &Geometry{Type: GeometryPolygon, Polygon: []Ring{bboxRing(west, south, east, north)}}
+}
+
+// newBBoxChecked returns a validated bounding box geometry.
+func newBBoxChecked(west, south, east, north float64) (*Geometry, error) {
+	if south > north {
+		return nil, fmt.Errorf("south %v is greater than north %v", south, north)
+	}
+	geom := NewBBox(west, south, east, north)
+	if err := geom.Validate(); err != nil {
+		return nil, err
+	}
+	return geom, nil
+}
+
+// boundsGeometry returns the geometry for extracted bounds, i.e., a Point if the bounds
+// are a single position or else a validated bounding box. Bounds that are a line have
+// no area and cannot be a Polygon, so they are logged and no geometry is returned.
+func boundsGeometry(west, south, east, north float64) (*Geometry, error) {
+	if west == east && south == north {
+		return NewPoint(west, south), nil
+	}
+	if south <= north && (west == east || south == north) {
+		slog.Warn("bounds have no area, not setting geometry",
+			"west", west, "south", south, "east", east, "north", north)
+		return nil, nil
+	}
+	return newBBoxChecked(west, south, east, north)
+}
+
+// bboxRing returns a counterclockwise ring for a bounding box
+func bboxRing(west, south, east, north float64) Ring {
+	return Ring{{west, south}, {east, south}, {east, north}, {west, north}, {west, south}}
+}
+
+// Validate checks that coordinates are in range, polygon rings are closed, and that
+// rings follow the RFC 7946 right-hand rule, i.e., exterior rings are counterclockwise
+// and holes are clockwise.
+func (g *Geometry) Validate() error {
+	switch g.Type {
+	case GeometryPoint:
+		return validatePosition(g.Point)
+	case GeometryPolygon:
+		return validatePolygon(g.Polygon)
+	case GeometryMultiPolygon:
+		if len(g.MultiPolygon) == 0 {
+			return fmt.Errorf("multipolygon has no polygons")
+		}
+		for i, poly := range g.MultiPolygon {
+			if err := validatePolygon(poly); err != nil {
+				return fmt.Errorf("polygon %d: %w", i, err)
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported geometry type: %q", g.Type)
+}
+
+func validatePosition(pos Position) error {
+	if len(pos) != 2 && len(pos) != 3 {
+		return fmt.Errorf("position must have 2 or 3 values, got %d", len(pos))
+	}
+	for _, v := range pos {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return fmt.Errorf("invalid position %v", pos)
+		}
+	}
+	if pos[0] < -180 || pos[0] > 180 {
+		return fmt.Errorf("longitude %v out of range [-180, 180]", pos[0])
+	}
+	if pos[1] < -90 || pos[1] > 90 {
+		return fmt.Errorf("latitude %v out of range [-90, 90]", pos[1])
+	}
+	return nil
+}
+
+func validatePolygon(rings []Ring) error {
+	if len(rings) == 0 {
+		return fmt.Errorf("polygon has no rings")
+	}
+	for i, ring := range rings {
+		if len(ring) < 4 {
+			return fmt.Errorf("ring %d must have at least 4 positions", i)
+		}
+		for _, pos := range ring {
+			if err := validatePosition(pos); err != nil {
+				return fmt.Errorf("ring %d: %w", i, err)
+			}
+		}
+		first, last := ring[0], ring[len(ring)-1]
+		if first[0] != last[0] || first[1] != last[1] {
+			return fmt.Errorf("ring %d is not closed", i)
+		}
+		area := ringArea(ring)
+		switch {
+		case area == 0:
+			return fmt.Errorf("ring %d has no area", i)
+		case i == 0 && area < 0:
+			return fmt.Errorf("exterior ring must be counterclockwise")
+		case i > 0 && area > 0:
+			return fmt.Errorf("ring %d (hole) must be clockwise", i)
+		}
+	}
+	return nil
+}
+
+// ringArea returns the signed area of ring in degrees, which is positive for
+// counterclockwise rings.
+func ringArea(ring Ring) float64 {
+	area := 0.0
+	for i := 0; i < len(ring)-1; i++ {
+		area += ring[i][0]*ring[i+1][1] - ring[i+1][0]*ring[i][1]
+	}
+	return area / 2
+}
+
+// ParseGeometry parses a GeoJSON geometry, or a Feature containing a geometry. If value
+// does not look like JSON it is treated as a path to a file containing the GeoJSON.
+func ParseGeometry(value string) (*Geometry, error) {
+	dat := []byte(value)
+	if !strings.HasPrefix(strings.TrimSpace(value), "{") {
+		var err error
+		dat, err = os.ReadFile(value)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var typ struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(dat, &typ); err != nil {
+		return nil, fmt.Errorf("invalid geojson: %w", err)
+	}
+	geom := &Geometry{}
+	if typ.Type == "Feature" {
+		var feature struct {
+			Geometry *Geometry `json:"geometry"`
+		}
+		if err := json.Unmarshal(dat, &feature); err != nil {
+			return nil, fmt.Errorf("invalid geojson: %w", err)
+		}
+		if feature.Geometry == nil {
+			return nil, fmt.Errorf("feature has no geometry")
+		}
+		geom = feature.Geometry
+	} else if err := json.Unmarshal(dat, geom); err != nil {
+		return nil, fmt.Errorf("invalid geojson: %w", err)
+	}
+	if err := geom.Validate(); err != nil {
+		return nil, err
+	}
+	return geom, nil
+}
+
+func parseFloats(value string, min, max int) ([]float64, error) {
+	parts := strings.Split(value, ",")
+	if len(parts) < min || len(parts) > max {
+		return nil, fmt.Errorf("expected %d to %d comma separated values", min, max)
+	}
+	vals := make([]float64, len(parts))
+	for i, p := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value %q", p)
+		}
+		vals[i] = v
+	}
+	return vals, nil
+}
+
+// ParsePoint parses a point of the form lon,lat[,z].
+func ParsePoint(value string) (*Geometry, error) {
+	vals, err := parseFloats(value, 2, 3)
+	if err != nil {
+		return nil, fmt.Errorf("invalid point: %w", err)
+	}
+	geom := NewPoint(vals[0], vals[1], vals[2:]...)
+	if err := geom.Validate(); err != nil {
+		return nil, err
+	}
+	return geom, nil
+}
+
+// ParseBBox parses a bounding box of the form west,south,east,north. Boxes crossing the
+// antimeridian have west greater than east.
+func ParseBBox(value string) (*Geometry, error) {
+	vals, err := parseFloats(value, 4, 4)
+	if err != nil {
+		return nil, fmt.Errorf("invalid bbox: %w", err)
+	}
+	geom, err := newBBoxChecked(vals[0], vals[1], vals[2], vals[3])
+	if err != nil {
+		return nil, fmt.Errorf("invalid bbox: %w", err)
+	}
+	return geom, nil
+}
@@ -0,0 +1,117 @@
+package internal
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGeometryJSON(t *testing.T) {
+	cases := []struct {
+		name string
+		geom *Geometry
+		json string
+	}{
+		{"point", NewPoint(-89.4, 43.1), `{"type":"Point","coordinates":[-89.4,43.1]}`},
+		{"point with z", NewPoint(-89.4, 43.1, 270), `{"type":"Point","coordinates":[-89.4,43.1,270]}`},
+		{"bbox", NewBBox(-100, 20, -80, 40), `{"type":"Polygon","coordinates":[[[-100,20],[-80,20],[-80,40],[-100,40],[-100,20]]]}`},
+		{"multipolygon", &Geometry{Type: GeometryMultiPolygon, MultiPolygon: [][]Ring{
+			{bboxRing(170, -10, 180, 10)},
+			{bboxRing(-180, -10, -170, 10)},
+		}}, `{"type":"MultiPolygon","coordinates":[[[[170,-10],[180,-10],[180,10],[170,10],[170,-10]]],[[[-180,-10],[-170,-10],[-170,10],[-180,10],[-180,-10]]]]}`},
+	}
+	for _, test := range cases {
+		dat, err := json.Marshal(test.geom)
+		require.NoError(t, err, test.name)
+		require.JSONEq(t, test.json, string(dat), test.name)
+
+		decoded := &Geometry{}
+		require.NoError(t, json.Unmarshal(dat, decoded), test.name)
+		require.Equal(t, test.geom, decoded, test.name)
+		require.NoError(t, decoded.Validate(), test.name)
+	}
+
+	require.Error(t, json.Unmarshal([]byte(`{"type":"LineString","coordinates":[[0,0],[1,1]]}`), &Geometry{}))
+	_, err := json.Marshal(&Geometry{Type: "Bogus"})
+	require.Error(t, err)
+}
+
+func TestGeometryValidate(t *testing.T) {
+	cases := []struct {
+		name string
+		geom *Geometry
+	}{
+		{"lon range", NewPoint(181, 0)},
+		{"lat range", NewPoint(0, -91)},
+		{"too many values", &Geometry{Type: GeometryPoint, Point: Position{0, 0, 0, 0}}},
+		{"not closed", &Geometry{Type: GeometryPolygon, Polygon: []Ring{{{0, 0}, {1, 0}, {1, 1}, {0, 1}}}}},
+		{"clockwise exterior", &Geometry{Type: GeometryPolygon, Polygon: []Ring{{{0, 0}, {0, 1}, {1, 1}, {1, 0}, {0, 0}}}}},
+		{"counterclockwise hole", &Geometry{Type: GeometryPolygon, Polygon: []Ring{
+			bboxRing(0, 0, 10, 10),
+			bboxRing(2, 2, 4, 4),
+		}}},
+		{"no area", &Geometry{Type: GeometryPolygon, Polygon: []Ring{{{0, 0}, {1, 1}, {2, 2}, {0, 0}}}}},
+		{"empty multipolygon", &Geometry{Type: GeometryMultiPolygon}},
+	}
+	for _, test := range cases {
+		require.Error(t, test.geom.Validate(), test.name)
+	}
+
+	// clockwise hole is ok
+	hole := bboxRing(2, 2, 4, 4)
+	for i, j := 0, len(hole)-1; i < j; i, j = i+1, j-1 {
+		hole[i], hole[j] = hole[j], hole[i]
+	}
+	geom := &Geometry{Type: GeometryPolygon, Polygon: []Ring{bboxRing(0, 0, 10, 10), hole}}
+	require.NoError(t, geom.Validate())
+}
+
+func TestParseGeometry(t *testing.T) {
+	geom, err := ParseGeometry(`{"type": "Point", "coordinates": [10, 20]}`)
+	require.NoError(t, err)
+	require.Equal(t, NewPoint(10, 20), geom)
+
+	fpath := filepath.Join(t.TempDir(), "feature.geojson")
+	require.NoError(t, os.WriteFile(fpath, []byte(`{
+		"type": "Feature",
+		"properties": {},
+		"geometry": {"type": "Polygon", "coordinates": [[[-100,20],[-80,20],[-80,40],[-100,40],[-100,20]]]}
+	}`), 0o644))
+	geom, err = ParseGeometry(fpath)
+	require.NoError(t, err)
+	require.Equal(t, NewBBox(-100, 20, -80, 40), geom)
+
+	_, err = ParseGeometry(`{"type": "Point", "coordinates": [200, 20]}`)
+	require.Error(t, err)
+	_, err = ParseGeometry(`{"type": "Feature", "geometry": null}`)
+	require.Error(t, err)
+	_, err = ParseGeometry(filepath.Join(t.TempDir(), "missing.geojson"))
+	require.Error(t, err)
+}
+
+func TestParsePointAndBBox(t *testing.T) {
+	geom, err := ParsePoint("-89.4,43.1")
+	require.NoError(t, err)
+	require.Equal(t, NewPoint(-89.4, 43.1), geom)
+
+	geom, err = ParsePoint("-89.4, 43.1, 270")
+	require.NoError(t, err)
+	require.Equal(t, NewPoint(-89.4, 43.1, 270), geom)
+
+	_, err = ParsePoint("-89.4")
+	require.Error(t, err)
+	_, err = ParsePoint("x,y")
+	require.Error(t, err)
+
+	geom, err = ParseBBox("-100,20,-80,40")
+	require.NoError(t, err)
+	require.Equal(t, NewBBox(-100, 20, -80, 40), geom)
+
+	_, err = ParseBBox("-100,40,-80,20")
+	require.Error(t, err)
+	_, err = ParseBBox("-100,20,-80")
+	require.Error(t, err)
+}
@@ -0,0 +1,322 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"time"
+)
+
+// errGRIBEdition is returned for GRIB messages that are not GRIB2
+var errGRIBEdition = errors.New("unsupported grib edition")
+
+// gribArea is the bounding box of a grid. west is greater than east for grids crossing
+// the antimeridian.
+type gribArea struct {
+	west, south, east, north float64
+}
+
+// gribField are the values of a GRIB2 field used for notifications
+type gribField struct {
+	// start and end of the valid time of the field. end is only set for statistically
+	// processed fields, e.g., accumulations.
+	start, end time.Time
+	area       *gribArea
+}
+
+// ExtractGRIB2Fields extracts the valid times and area of the fields in a GRIB2 file. The
+// valid time of a field is the section 1 reference time plus the section 4 forecast
+// time, and extends to the end of the time interval for statistically processed
+// fields. If all fields are valid at the same time it is used as the datetime,
+// otherwise the start and end datetimes cover all fields.
+//
+// The area is the bounding box of the section 3 grid for latitude/longitude, Gaussian
+// and Mercator grids. It is not set for other grids, or when the fields use different
+// grids that cannot be combined.
+func ExtractGRIB2Fields(fpath string) (*Extracted, error) {
+	dat, err := os.ReadFile(fpath)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields []gribField
+	nmsgs := 0
+	for len(dat) > 0 {
+		idx := bytes.Index(dat, []byte("GRIB"))
+		if idx < 0 {
+			break
+		}
+		nmsgs++
+		msgFields, n, err := parseGRIB2Message(dat[idx:])
+		if err != nil {
+			return nil, fmt.Errorf("message %d: %w", nmsgs, err)
+		}
+		fields = append(fields, msgFields...)
+		dat = dat[idx+n:]
+	}
+	if nmsgs == 0 {
+		return nil, fmt.Errorf("no grib messages found")
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("no grib fields found")
+	}
+
+	zult := &Extracted{}
+	times := []time.Time{}
+	for _, f := range fields {
+		times = append(times, f.start)
+		if !f.end.IsZero() {
+			times = append(times, f.end)
+		}
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+	zult.Start = FormatDatetime(times[0], time.Second)
+	if end := FormatDatetime(times[len(times)-1], time.Second); end != zult.Start {
+		zult.End = end
+	}
+
+	area := fields[0].area
+	for _, f := range fields[1:] {
+		area = area.union(f.area)
+	}
+	if area != nil {
+		zult.Geometry, err = boundsGeometry(area.west, area.south, area.east, area.north)
+		if err != nil {
+			return nil, fmt.Errorf("invalid grid area: %w", err)
+		}
+	}
+	return zult, nil
+}
+
+// union returns the area covering a and b, or nil if either is nil or they cannot be
+// combined because one crosses the antimeridian.
+func (a *gribArea) union(b *gribArea) *gribArea {
+	if a == nil || b == nil {
+		return nil
+	}
+	if *a == *b {
+		return a
+	}
+	if a.west > a.east || b.west > b.east {
+		return nil
+	}
+	return &gribArea{
+		west:  math.Min(a.west, b.west),
+		south: math.Min(a.south, b.south),
+		east:  math.Max(a.east, b.east),
+		north: math.Max(a.north, b.north),
+	}
+}
+
+// parseGRIB2Message parses the GRIB2 message at the start of dat, returning a field for
+// each product definition section and the total length of the message.
+func parseGRIB2Message(dat []byte) ([]gribField, int, error) {
+	if len(dat) < 16 {
+		return nil, 0, fmt.Errorf("truncated grib message")
+	}
+	if edition := dat[7]; edition != 2 {
+		return nil, 0, fmt.Errorf("%w %d", errGRIBEdition, edition)
+	}
+	total := binary.BigEndian.Uint64(dat[8:16])
+	if total > uint64(len(dat)) {
+		return nil, 0, fmt.Errorf("truncated grib message")
+	}
+	dat = dat[:total]
+
+	var fields []gribField
+	var ref time.Time
+	var area *gribArea
+	var err error
+	for off := 16; off < len(dat); {
+		if string(dat[off:min(off+4, len(dat))]) == "7777" {
+			return fields, int(total), nil
+		}
+		if off+5 > len(dat) {
+			break
+		}
+		n := int(binary.BigEndian.Uint32(dat[off:]))
+		if n < 5 || off+n > len(dat) {
+			return nil, 0, fmt.Errorf("invalid section length %d", n)
+		}
+		sec := dat[off : off+n]
+		switch sec[4] {
+		case 1:
+			if len(sec) < 19 {
+				return nil, 0, fmt.Errorf("section 1 too short")
+			}
+			ref = time.Date(int(binary.BigEndian.Uint16(sec[12:])), time.Month(sec[14]), int(sec[15]),
+				int(sec[16]), int(sec[17]), int(sec[18]), 0, time.UTC)
+		case 3:
+			area, err = gribGridArea(sec)
+			if err != nil {
+				return nil, 0, fmt.Errorf("section 3: %w", err)
+			}
+		case 4:
+			if ref.IsZero() {
+				return nil, 0, fmt.Errorf("section 4 before section 1")
+			}
+			f, err := gribProductTimes(sec, ref)
+			if err != nil {
+				return nil, 0, fmt.Errorf("section 4: %w", err)
+			}
+			f.area = area
+			fields = append(fields, f)
+		}
+		off += n
+	}
+	return nil, 0, fmt.Errorf("missing end section")
+}
+
+// gribSigned decodes a GRIB2 sign and magnitude integer
+func gribSigned(b []byte) int64 {
+	v := binary.BigEndian.Uint32(b)
+	if v&0x80000000 != 0 {
+		return -int64(v & 0x7fffffff)
+	}
+	return int64(v)
+}
+
+// gribGridArea returns the area of a grid definition section. nil is returned for
+// unsupported grid definition templates.
+func gribGridArea(sec []byte) (*gribArea, error) {
+	if len(sec) < 14 {
+		return nil, fmt.Errorf("too short")
+	}
+	tmpl := binary.BigEndian.Uint16(sec[12:])
+
+	// offsets of the first and last grid points, i direction increment, and scanning mode
+	var la1, lo1, la2, lo2, scan, di int
+	switch tmpl {
+	case 0, 40:
+		// latitude/longitude and Gaussian
+		la1, lo1, la2, lo2, di, scan = 46, 50, 55, 59, 63, 71
+	case 10:
+		// Mercator, the increments are in metres
+		la1, lo1, la2, lo2, di, scan = 38, 42, 51, 55, -1, 59
+	default:
+		return nil, nil
+	}
+	if len(sec) <= scan {
+		return nil, fmt.Errorf("grid definition template 3.%d too short", tmpl)
+	}
+	units := 1e-6
+	if tmpl != 10 {
+		basic, sub := binary.BigEndian.Uint32(sec[38:]), binary.BigEndian.Uint32(sec[42:])
+		if basic != 0 && basic != math.MaxUint32 && sub != 0 && sub != math.MaxUint32 {
+			units = float64(basic) / float64(sub)
+		}
+	}
+
+	lat1, lat2 := float64(gribSigned(sec[la1:]))*units, float64(gribSigned(sec[la2:]))*units
+	lon1, lon2 := float64(gribSigned(sec[lo1:]))*units, float64(gribSigned(sec[lo2:]))*units
+	if sec[scan]&0x80 != 0 {
+		// points scan in the -i direction
+		lon1, lon2 = lon2, lon1
+	}
+	inc := 0.0
+	if di >= 0 && binary.BigEndian.Uint32(sec[di:]) != math.MaxUint32 {
+		inc = float64(binary.BigEndian.Uint32(sec[di:])) * units
+	}
+
+	area := &gribArea{
+		south: math.Round(math.Min(lat1, lat2)*1e6) / 1e6,
+		north: math.Round(math.Max(lat1, lat2)*1e6) / 1e6,
+	}
+	span := math.Mod(lon2-lon1+720, 360)
+	if span+inc >= 360 || (span == 0 && lon1 != lon2) {
+		area.west, area.east = -180, 180
+	} else {
+		area.west = math.Round(normalizeLon(math.Mod(lon1+360, 360))*1e6) / 1e6
+		area.east = math.Round(normalizeLon(math.Mod(lon2+360, 360))*1e6) / 1e6
+	}
+	return area, nil
+}
+
+// gribTimeUnit returns the time after adding n units of Code Table 4.4 to t
+func gribTimeUnit(t time.Time, unit byte, n int64) (time.Time, error) {
+	switch unit {
+	case 0:
+		return t.Add(time.Duration(n) * time.Minute), nil
+	case 1:
+		return t.Add(time.Duration(n) * time.Hour), nil
+	case 2:
+		return t.AddDate(0, 0, int(n)), nil
+	case 3:
+		return t.AddDate(0, int(n), 0), nil
+	case 4:
+		return t.AddDate(int(n), 0, 0), nil
+	case 5:
+		return t.AddDate(10*int(n), 0, 0), nil
+	case 6:
+		return t.AddDate(30*int(n), 0, 0), nil
+	case 7:
+		return t.AddDate(100*int(n), 0, 0), nil
+	case 10:
+		return t.Add(time.Duration(n) * 3 * time.Hour), nil
+	case 11:
+		return t.Add(time.Duration(n) * 6 * time.Hour), nil
+	case 12:
+		return t.Add(time.Duration(n) * 12 * time.Hour), nil
+	case 13:
+		return t.Add(time.Duration(n) * time.Second), nil
+	}
+	return time.Time{}, fmt.Errorf("unsupported time unit %d", unit)
+}
+
+// gribIntervalEnd are the offsets of the end of the overall time interval for the
+// statistically processed product definition templates
+var gribIntervalEnd = map[uint16]int{
+	8:  34,
+	9:  47,
+	10: 35,
+	11: 37,
+	12: 36,
+	13: 68,
+	14: 64,
+	42: 36,
+	43: 39,
+}
+
+// gribProductTimes returns the valid times of a product definition section. Templates
+// 4.0 to 4.15, and the atmospheric chemical constituent templates 4.40 to 4.43, have a
+// forecast time, other templates use the reference time.
+func gribProductTimes(sec []byte, ref time.Time) (gribField, error) {
+	f := gribField{start: ref}
+	if len(sec) < 9 {
+		return f, fmt.Errorf("too short")
+	}
+	tmpl := binary.BigEndian.Uint16(sec[7:])
+	// offset of the forecast time unit, the chemical constituent templates add the
+	// constituent type before it
+	unit := 17
+	switch {
+	case tmpl <= 15:
+	case tmpl >= 40 && tmpl <= 43:
+		unit += 2
+	default:
+		return f, nil
+	}
+	if len(sec) < unit+5 {
+		return f, fmt.Errorf("product definition template 4.%d too short", tmpl)
+	}
+	var err error
+	f.start, err = gribTimeUnit(ref, sec[unit], int64(binary.BigEndian.Uint32(sec[unit+1:])))
+	if err != nil {
+		return f, err
+	}
+	if off, ok := gribIntervalEnd[tmpl]; ok {
+		if len(sec) < off+7 {
+			return f, fmt.Errorf("product definition template 4.%d too short", tmpl)
+		}
+		f.end = time.Date(int(binary.BigEndian.Uint16(sec[off:])), time.Month(sec[off+2]), int(sec[off+3]),
+			int(sec[off+4]), int(sec[off+5]), int(sec[off+6]), 0, time.UTC)
+		if f.end.Before(f.start) {
+			return f, fmt.Errorf("end of time interval is before the forecast time")
+		}
+	}
+	return f, nil
+}
@@ -0,0 +1,218 @@
+package internal
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func gribSection(num byte, size int) []byte {
+	sec := make([]byte, size)
+	binary.BigEndian.PutUint32(sec, uint32(size))
+	sec[4] = num
+	return sec
+}
+
+func putGribSigned(b []byte, v float64) {
+	u := uint32(v * 1e6)
+	if v < 0 {
+		u = uint32(-v*1e6) | 0x80000000
+	}
+	binary.BigEndian.PutUint32(b, u)
+}
+
+// gribRefTime returns section 1 with a reference time of 2024-01-02 00:00
+func gribRefTime() []byte {
+	sec := gribSection(1, 21)
+	binary.BigEndian.PutUint16(sec[12:], 2024)
+	sec[14], sec[15] = 1, 2
+	return sec
+}
+
+// gribLatLon returns a section 3 template 3.0 grid
+func gribLatLon(la1, lo1, la2, lo2, di float64) []byte {
+	sec := gribSection(3, 72)
+	binary.BigEndian.PutUint16(sec[12:], 0)
+	putGribSigned(sec[46:], la1)
+	putGribSigned(sec[50:], lo1)
+	putGribSigned(sec[55:], la2)
+	putGribSigned(sec[59:], lo2)
+	binary.BigEndian.PutUint32(sec[63:], uint32(di*1e6))
+	return sec
+}
+
+// gribForecast returns a section 4 template 4.0 product with a forecast time in hours
+func gribForecast(hours uint32) []byte {
+	sec := gribSection(4, 34)
+	sec[17] = 1
+	binary.BigEndian.PutUint32(sec[18:], hours)
+	return sec
+}
+
+// gribAccum returns a section 4 template 4.8 product for an accumulation from start to
+// end hours on 2024-01-02
+func gribAccum(start, end uint32) []byte {
+	sec := gribSection(4, 70)
+	binary.BigEndian.PutUint16(sec[7:], 8)
+	sec[17] = 1
+	binary.BigEndian.PutUint32(sec[18:], start)
+	binary.BigEndian.PutUint16(sec[34:], 2024)
+	sec[36], sec[37], sec[38] = 1, 2, byte(end)
+	return sec
+}
+
+func buildGRIB2(sections ...[]byte) []byte {
+	msg := []byte{'G', 'R', 'I', 'B', 0, 0, 0, 2, 0, 0, 0, 0, 0, 0, 0, 0}
+	for _, sec := range sections {
+		msg = append(msg, sec...)
+	}
+	msg = append(msg, "7777"...)
+	binary.BigEndian.PutUint64(msg[8:], uint64(len(msg)))
+	return msg
+}
+
+func writeGRIB(t *testing.T, msgs ...[]byte) string {
+	fpath := filepath.Join(t.TempDir(), "model.grib2")
+	dat := []byte{}
+	for _, msg := range msgs {
+		dat = append(dat, msg...)
+	}
+	require.NoError(t, os.WriteFile(fpath, dat, 0o644))
+	return fpath
+}
+
+func TestExtractGRIB2Fields(t *testing.T) {
+	t.Run("global forecast", func(t *testing.T) {
+		msg := buildGRIB2(gribRefTime(), gribLatLon(90, 0, -90, 359.75, 0.25), gribForecast(6))
+		zult, err := ExtractGRIB2Fields(writeGRIB(t, msg))
+		require.NoError(t, err)
+		require.Equal(t, NewBBox(-180, -90, 180, 90), zult.Geometry)
+		require.Equal(t, "2024-01-02T06:00:00Z", zult.Start)
+		require.Empty(t, zult.End)
+	})
+
+	t.Run("accumulation", func(t *testing.T) {
+		msg := buildGRIB2(gribRefTime(), gribLatLon(20, 230, 50, 300, 0.5), gribForecast(0), gribAccum(0, 6))
+		zult, err := ExtractGRIB2Fields(writeGRIB(t, msg))
+		require.NoError(t, err)
+		require.Equal(t, NewBBox(-130, 20, -60, 50), zult.Geometry)
+		require.Equal(t, "2024-01-02T00:00:00Z", zult.Start)
+		require.Equal(t, "2024-01-02T06:00:00Z", zult.End)
+	})
+
+	t.Run("antimeridian", func(t *testing.T) {
+		msg := buildGRIB2(gribRefTime(), gribLatLon(10, 170, -10, 190, 0.5), gribForecast(0))
+		zult, err := ExtractGRIB2Fields(writeGRIB(t, msg))
+		require.NoError(t, err)
+		require.Equal(t, GeometryMultiPolygon, zult.Geometry.Type)
+		require.NoError(t, zult.Geometry.Validate())
+	})
+
+	t.Run("multiple messages", func(t *testing.T) {
+		msg1 := buildGRIB2(gribRefTime(), gribLatLon(20, -100, 40, -80, 0.5), gribForecast(3))
+		msg2 := buildGRIB2(gribRefTime(), gribLatLon(30, -90, 50, -70, 0.5), gribForecast(12))
+		zult, err := ExtractGRIB2Fields(writeGRIB(t, msg1, msg2))
+		require.NoError(t, err)
+		require.Equal(t, NewBBox(-100, 20, -70, 50), zult.Geometry)
+		require.Equal(t, "2024-01-02T03:00:00Z", zult.Start)
+		require.Equal(t, "2024-01-02T12:00:00Z", zult.End)
+	})
+
+	t.Run("unsupported grid", func(t *testing.T) {
+		grid := gribSection(3, 72)
+		binary.BigEndian.PutUint16(grid[12:], 30)
+		zult, err := ExtractGRIB2Fields(writeGRIB(t, buildGRIB2(gribRefTime(), grid, gribForecast(0))))
+		require.NoError(t, err)
+		require.Nil(t, zult.Geometry)
+		require.Equal(t, "2024-01-02T00:00:00Z", zult.Start)
+	})
+
+	t.Run("no area", func(t *testing.T) {
+		msg := buildGRIB2(gribRefTime(), gribLatLon(30, -100, 30, -80, 0.5), gribForecast(3))
+		zult, err := ExtractGRIB2Fields(writeGRIB(t, msg))
+		require.NoError(t, err)
+		require.Nil(t, zult.Geometry)
+		require.Equal(t, "2024-01-02T03:00:00Z", zult.Start)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		msg := buildGRIB2(gribRefTime(), gribForecast(0))
+		msg[7] = 1
+		_, err := ExtractGRIB2Fields(writeGRIB(t, msg))
+		require.Error(t, err)
+
+		msg = buildGRIB2(gribRefTime(), gribForecast(0))
+		_, err = ExtractGRIB2Fields(writeGRIB(t, msg[:len(msg)-4]))
+		require.Error(t, err)
+
+		_, err = ExtractGRIB2Fields(writeGRIB(t, buildGRIB2(gribForecast(0))))
+		require.Error(t, err)
+
+		_, err = ExtractGRIB2Fields(writeGRIB(t, []byte("not grib")))
+		require.Error(t, err)
+	})
+
+	t.Run("auto", func(t *testing.T) {
+		extractor, err := NewExtractor(ExtractAuto, "application/grib")
+		require.NoError(t, err)
+
+		grib1 := buildGRIB2(gribRefTime(), gribForecast(0))
+		grib1[7] = 1
+		zult, err := extractor(writeGRIB(t, grib1))
+		require.NoError(t, err, "grib1 is skipped")
+		require.Equal(t, &Extracted{}, zult)
+
+		zult, err = extractor(writeGRIB(t, []byte("not grib")))
+		require.NoError(t, err, "errors are warnings")
+		require.Equal(t, &Extracted{}, zult)
+
+		msg := buildGRIB2(gribRefTime(), gribLatLon(20, -100, 40, -80, 0.5), gribForecast(3))
+		zult, err = extractor(writeGRIB(t, msg))
+		require.NoError(t, err)
+		require.Equal(t, "2024-01-02T03:00:00Z", zult.Start)
+	})
+}
+
+func TestGRIBProductTimes(t *testing.T) {
+	ref := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	cases := []struct {
+		tmpl       uint16
+		unit, end  int
+		start, fin string
+	}{
+		{0, 17, -1, "2024-01-02T03:00:00Z", ""},
+		{8, 17, 34, "2024-01-02T03:00:00Z", "2024-01-02T06:00:00Z"},
+		{13, 17, 68, "2024-01-02T03:00:00Z", "2024-01-02T06:00:00Z"},
+		{14, 17, 64, "2024-01-02T03:00:00Z", "2024-01-02T06:00:00Z"},
+		{40, 19, -1, "2024-01-02T03:00:00Z", ""},
+		{42, 19, 36, "2024-01-02T03:00:00Z", "2024-01-02T06:00:00Z"},
+		{43, 19, 39, "2024-01-02T03:00:00Z", "2024-01-02T06:00:00Z"},
+		// templates without a forecast time use the reference time
+		{30, -1, -1, "2024-01-02T00:00:00Z", ""},
+		{48, -1, -1, "2024-01-02T00:00:00Z", ""},
+	}
+	for _, test := range cases {
+		sec := gribSection(4, 100)
+		binary.BigEndian.PutUint16(sec[7:], test.tmpl)
+		if test.unit >= 0 {
+			sec[test.unit] = 1
+			binary.BigEndian.PutUint32(sec[test.unit+1:], 3)
+		}
+		if test.end >= 0 {
+			binary.BigEndian.PutUint16(sec[test.end:], 2024)
+			sec[test.end+2], sec[test.end+3], sec[test.end+4] = 1, 2, 6
+		}
+		f, err := gribProductTimes(sec, ref)
+		require.NoError(t, err, "template 4.%d", test.tmpl)
+		require.Equal(t, test.start, FormatDatetime(f.start, time.Second), "template 4.%d", test.tmpl)
+		if test.fin == "" {
+			require.True(t, f.end.IsZero(), "template 4.%d", test.tmpl)
+		} else {
+			require.Equal(t, test.fin, FormatDatetime(f.end, time.Second), "template 4.%d", test.tmpl)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package internal
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sync"
+)
+
+// HistoryRecord is a published notification in the local history
+type HistoryRecord struct {
+	DataID    string    `json:"data_id"`
+	PubTime   string    `json:"pubtime"`
+	Integrity Integrity `json:"integrity"`
+}
+
+// History is a local history of published notifications, stored as JSON lines, used to
+// detect a data_id being reused for different content.
+type History struct {
+	mu      sync.Mutex
+	fpath   string
+	records map[string]HistoryRecord
+}
+
+// OpenHistory opens the history at fpath. The file is created when the first record is
+// added if it does not exist.
+func OpenHistory(fpath string) (*History, error) {
+	h := &History{fpath: fpath, records: map[string]HistoryRecord{}}
+	f, err := os.Open(fpath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return h, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		rec := HistoryRecord{}
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return nil, fmt.Errorf("reading history %s: line %d: %w", fpath, line, err)
+		}
+		h.records[rec.DataID] = rec
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading history %s: %w", fpath, err)
+	}
+	return h, nil
+}
+
+// Conflict returns the most recent record for dataID if it was published with content
+// different from integrity. Checksums by different methods cannot be compared so are not
+// a conflict.
+func (h *History) Conflict(dataID string, integrity Integrity) (HistoryRecord, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	rec, ok := h.records[dataID]
+	if !ok || rec.Integrity.Method != integrity.Method || rec.Integrity.Value == integrity.Value {
+		return HistoryRecord{}, false
+	}
+	return rec, true
+}
+
+// Add appends a record to the history
+func (h *History) Add(rec HistoryRecord) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	dat, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(h.fpath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(dat, '\n')); err != nil {
+		f.Close()
+		return fmt.Errorf("writing history %s: %w", h.fpath, err)
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	h.records[rec.DataID] = rec
+	return nil
+}
+
+// Lookup returns the most recent record for dataID.
+func (h *History) Lookup(dataID string) (HistoryRecord, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	rec, ok := h.records[dataID]
+	return rec, ok
+}
@@ -0,0 +1,49 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistory(t *testing.T) {
+	fpath := filepath.Join(t.TempDir(), "history.jsonl")
+	h, err := OpenHistory(fpath)
+	require.NoError(t, err)
+
+	a := Integrity{Method: "sha512", Value: "aaa"}
+	b := Integrity{Method: "sha512", Value: "bbb"}
+	_, conflict := h.Conflict("wis2/x/granule.nc", a)
+	require.False(t, conflict)
+	require.NoError(t, h.Add(HistoryRecord{DataID: "wis2/x/granule.nc", PubTime: "2024-01-02T03:04:05Z", Integrity: a}))
+
+	// reopen to check the records persist
+	h, err = OpenHistory(fpath)
+	require.NoError(t, err)
+	_, conflict = h.Conflict("wis2/x/granule.nc", a)
+	require.False(t, conflict)
+	prev, conflict := h.Conflict("wis2/x/granule.nc", b)
+	require.True(t, conflict)
+	require.Equal(t, "2024-01-02T03:04:05Z", prev.PubTime)
+	// checksums by different methods cannot be compared
+	_, conflict = h.Conflict("wis2/x/granule.nc", Integrity{Method: "sha256", Value: "ccc"})
+	require.False(t, conflict)
+
+	// the most recent record is used
+	require.NoError(t, h.Add(HistoryRecord{DataID: "wis2/x/granule.nc", Integrity: b}))
+	h, err = OpenHistory(fpath)
+	require.NoError(t, err)
+	_, conflict = h.Conflict("wis2/x/granule.nc", b)
+	require.False(t, conflict)
+	rec, ok := h.Lookup("wis2/x/granule.nc")
+	require.True(t, ok)
+	require.Equal(t, b, rec.Integrity)
+	_, ok = h.Lookup("wis2/x/other.nc")
+	require.False(t, ok)
+
+	require.NoError(t, os.WriteFile(fpath, []byte("not json\n"), 0o644))
+	_, err = OpenHistory(fpath)
+	require.Error(t, err)
+}
@@ -0,0 +1,227 @@
+package internal
+
+import (
+	"context"
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Input is a product file that a notification is generated for. It may be a local file
+// or an object on remote storage.
+type Input interface {
+	// Name is the base file name of the input.
+	Name() string
+	// URL is where the input can be downloaded from, or nil if it is a local file.
+	URL() *url.URL
+	// Open returns a reader for the input content.
+	Open(ctx context.Context) (io.ReadCloser, error)
+	// Info returns the size and integrity of the input.
+	Info(ctx context.Context) (*InputInfo, error)
+}
+
+// InputInfo is the information about an input required to construct a notification.
+type InputInfo struct {
+	Size      int64
+	Integrity Integrity
+}
+
+// InputConfig configures how remote inputs are accessed.
+type InputConfig struct {
+	// Client is used for HTTP requests. http.DefaultClient is used if nil.
+	Client *http.Client
+	// TrustMetadata allows size and integrity to be taken from remote response headers
+	// rather than streaming the content. Content is still streamed if the headers do
+	// not provide an integrity value.
+	TrustMetadata bool
+	S3            S3Config
+}
+
+func (c InputConfig) client() *http.Client {
+	if c.Client == nil {
+		return http.DefaultClient
+	}
+	return c.Client
+}
+
+// NewInput returns an Input for a local path, http(s):// URL or s3://<bucket>/<key> URL.
+func NewInput(location string, cfg InputConfig) (Input, error) {
+	u, err := url.Parse(location)
+	if err != nil || u.Scheme == "" || len(u.Scheme) == 1 {
+		// no scheme, or a windows drive letter
+		return &fileInput{path: location}, nil
+	}
+	switch u.Scheme {
+	case "file":
+		return &fileInput{path: u.Path}, nil
+	case "http", "https":
+		return &httpInput{url: u, cfg: cfg}, nil
+	case "s3":
+		bucket, key, err := parseS3URL(u)
+		if err != nil {
+			return nil, err
+		}
+		objURL, err := cfg.S3.ObjectURL(bucket, key)
+		if err != nil {
+			return nil, err
+		}
+		return &httpInput{url: objURL, cfg: cfg, s3: true}, nil
+	}
+	return nil, fmt.Errorf("unsupported input scheme: %s", u.Scheme)
+}
+
+// digest computes the integrity and length of the content of r.
+func digest(r io.Reader) (*Integrity, int64, error) {
+	start := time.Now()
+	h := sha512.New()
+	n, err := io.Copy(h, r)
+	checksumBytes.Add(float64(n))
+	if err != nil {
+		return nil, 0, err
+	}
+	checksumDuration.Observe(time.Since(start).Seconds())
+	return &Integrity{
+		Method: "sha512",
+		Value:  base64.StdEncoding.EncodeToString(h.Sum(nil)),
+	}, n, nil
+}
+
+type fileInput struct {
+	path string
+}
+
+func (i *fileInput) Name() string  { return filepath.Base(i.path) }
+func (i *fileInput) URL() *url.URL { return nil }
+
+func (i *fileInput) Open(_ context.Context) (io.ReadCloser, error) {
+	return os.Open(i.path)
+}
+
+func (i *fileInput) Info(ctx context.Context) (*InputInfo, error) {
+	f, err := i.Open(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	csum, size, err := digest(f)
+	if err != nil {
+		return nil, fmt.Errorf("checksumming: %w", err)
+	}
+	return &InputInfo{Size: size, Integrity: *csum}, nil
+}
+
+// httpInput is an object served over HTTP. S3 objects are accessed the same way, with
+// requests signed when credentials are configured.
+type httpInput struct {
+	url *url.URL
+	cfg InputConfig
+	s3  bool
+}
+
+func (i *httpInput) Name() string  { return path.Base(i.url.Path) }
+func (i *httpInput) URL() *url.URL { return i.url }
+
+func (i *httpInput) do(ctx context.Context, method string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, i.url.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if i.s3 {
+		if method == http.MethodHead {
+			req.Header.Set("X-Amz-Checksum-Mode", "ENABLED")
+		}
+		i.cfg.S3.sign(req, "", time.Now())
+	}
+	resp, err := i.cfg.client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s %s: %s", method, i.url.Redacted(), resp.Status)
+	}
+	return resp, nil
+}
+
+func (i *httpInput) Open(ctx context.Context) (io.ReadCloser, error) {
+	resp, err := i.do(ctx, http.MethodGet)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (i *httpInput) Info(ctx context.Context) (*InputInfo, error) {
+	if i.cfg.TrustMetadata {
+		resp, err := i.do(ctx, http.MethodHead)
+		if err != nil {
+			return nil, err
+		}
+		resp.Body.Close()
+		if integrity := integrityFromHeader(resp.Header); integrity != nil && resp.ContentLength >= 0 {
+			return &InputInfo{Size: resp.ContentLength, Integrity: *integrity}, nil
+		}
+	}
+
+	resp, err := i.do(ctx, http.MethodGet)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	csum, size, err := digest(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("checksumming: %w", err)
+	}
+	if resp.ContentLength >= 0 && resp.ContentLength != size {
+		return nil, fmt.Errorf("short read: got %d bytes, expected %d", size, resp.ContentLength)
+	}
+	return &InputInfo{Size: size, Integrity: *csum}, nil
+}
+
+// compositeChecksumRegexp matches S3 checksums of multipart uploads
+var compositeChecksumRegexp = regexp.MustCompile(`-\d+$`)
+
+// integrityFromHeader returns the integrity advertised by the server in the response
+// headers, or nil if there is none in a form usable for a notification.
+//
+// ETags are not used because they are typically MD5 which is not an allowed integrity
+// method. S3 checksums of multipart uploads, with a -<part count> suffix, are not used
+// because they are checksums of the part checksums rather than of the content.
+func integrityFromHeader(h http.Header) *Integrity {
+	if v := h.Get("X-Amz-Checksum-Sha256"); v != "" && !compositeChecksumRegexp.MatchString(v) {
+		return &Integrity{Method: "sha256", Value: v}
+	}
+	// RFC 9530 (Repr-Digest: sha-512=:<base64>:) and RFC 3230 (Digest: SHA-512=<base64>)
+	found := map[string]string{}
+	for _, name := range []string{"Repr-Digest", "Digest"} {
+		for _, val := range h.Values(name) {
+			for _, item := range strings.Split(val, ",") {
+				alg, value, ok := strings.Cut(strings.TrimSpace(item), "=")
+				if !ok {
+					continue
+				}
+				alg = strings.ToLower(alg)
+				if _, exists := found[alg]; !exists {
+					found[alg] = strings.Trim(value, ":")
+				}
+			}
+		}
+	}
+	for _, alg := range []string{"sha-512", "sha-256"} {
+		if v, ok := found[alg]; ok && v != "" {
+			return &Integrity{Method: strings.Replace(alg, "-", "", 1), Value: v}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package internal
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func sha512b64(dat []byte) string {
+	sum := sha512.Sum512(dat)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func TestNewInput(t *testing.T) {
+	cases := []struct {
+		location string
+		name     string
+		url      string
+	}{
+		{"/data/foo.bufr", "foo.bufr", ""},
+		{"foo.bufr", "foo.bufr", ""},
+		{"file:///data/foo.bufr", "foo.bufr", ""},
+		{"https://server/data/foo.bufr", "foo.bufr", "https://server/data/foo.bufr"},
+		{"s3://bucket/path/to/foo.bufr", "foo.bufr", "http://minio:9000/bucket/path/to/foo.bufr"},
+	}
+	cfg := InputConfig{S3: S3Config{Endpoint: "http://minio:9000"}}
+	for _, test := range cases {
+		in, err := NewInput(test.location, cfg)
+		require.NoError(t, err, test.location)
+		require.Equal(t, test.name, in.Name(), test.location)
+		if test.url == "" {
+			require.Nil(t, in.URL(), test.location)
+		} else {
+			require.Equal(t, test.url, in.URL().String(), test.location)
+		}
+	}
+
+	_, err := NewInput("ftp://server/foo.bufr", cfg)
+	require.Error(t, err)
+	_, err = NewInput("s3://bucket", cfg)
+	require.Error(t, err)
+}
+
+func TestFileInputInfo(t *testing.T) {
+	content := []byte("some bufr content")
+	fpath := filepath.Join(t.TempDir(), "foo.bufr")
+	require.NoError(t, os.WriteFile(fpath, content, 0o644))
+
+	in, err := NewInput(fpath, InputConfig{})
+	require.NoError(t, err)
+	info, err := in.Info(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, int64(len(content)), info.Size)
+	require.Equal(t, Integrity{Method: "sha512", Value: sha512b64(content)}, info.Integrity)
+}
+
+func TestHTTPInputInfo(t *testing.T) {
+	content := []byte("some grib content")
+	var gets int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/data/foo.grib" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.URL.Query().Get("digest") != "" {
+			w.Header().Set("Repr-Digest", "sha-256=:abc=:, sha-512=:"+sha512b64(content)+":")
+		}
+		if r.Method == http.MethodGet {
+			gets++
+		}
+		w.Write(content)
+	}))
+	defer srv.Close()
+
+	t.Run("streamed", func(t *testing.T) {
+		gets = 0
+		in, err := NewInput(srv.URL+"/data/foo.grib", InputConfig{TrustMetadata: true})
+		require.NoError(t, err)
+		info, err := in.Info(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, int64(len(content)), info.Size)
+		require.Equal(t, Integrity{Method: "sha512", Value: sha512b64(content)}, info.Integrity)
+		require.Equal(t, 1, gets)
+	})
+
+	t.Run("trusted", func(t *testing.T) {
+		gets = 0
+		in, err := NewInput(srv.URL+"/data/foo.grib?digest=1", InputConfig{TrustMetadata: true})
+		require.NoError(t, err)
+		info, err := in.Info(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, int64(len(content)), info.Size)
+		require.Equal(t, Integrity{Method: "sha512", Value: sha512b64(content)}, info.Integrity)
+		require.Equal(t, 0, gets, "should not download when trusting metadata")
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		in, err := NewInput(srv.URL+"/data/bar.grib", InputConfig{})
+		require.NoError(t, err)
+		_, err = in.Info(context.Background())
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "404")
+	})
+}
+
+// A minimal stand-in for an S3 compatible server like MinIO
+func TestS3InputInfo(t *testing.T) {
+	content := []byte("some netcdf content")
+	sum := sha256.Sum256(content)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=KEY/") ||
+			!strings.Contains(auth, "/us-west-2/s3/aws4_request") ||
+			r.Header.Get("X-Amz-Date") == "" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if r.URL.EscapedPath() != "/bucket/path/foo%20bar.nc" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("X-Amz-Checksum-Mode") == "ENABLED" {
+			w.Header().Set("X-Amz-Checksum-Sha256", base64.StdEncoding.EncodeToString(sum[:]))
+		}
+		w.Write(content)
+	}))
+	defer srv.Close()
+
+	cfg := InputConfig{
+		TrustMetadata: true,
+		S3:            S3Config{Endpoint: srv.URL, Region: "us-west-2", AccessKey: "KEY", SecretKey: "SECRET"},
+	}
+	in, err := NewInput("s3://bucket/path/foo bar.nc", cfg)
+	require.NoError(t, err)
+	require.Equal(t, "foo bar.nc", in.Name())
+
+	info, err := in.Info(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, int64(len(content)), info.Size)
+	require.Equal(t, Integrity{Method: "sha256", Value: base64.StdEncoding.EncodeToString(sum[:])}, info.Integrity)
+
+	cfg.TrustMetadata = false
+	in, err = NewInput("s3://bucket/path/foo bar.nc", cfg)
+	require.NoError(t, err)
+	info, err = in.Info(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, Integrity{Method: "sha512", Value: sha512b64(content)}, info.Integrity)
+
+	cfg.S3.AccessKey = ""
+	in, err = NewInput("s3://bucket/path/foo bar.nc", cfg)
+	require.NoError(t, err)
+	_, err = in.Info(context.Background())
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "403")
+}
+
+func TestIntegrityFromHeader(t *testing.T) {
+	h := http.Header{}
+	require.Nil(t, integrityFromHeader(h))
+
+	h.Set("X-Amz-Checksum-Sha256", "abc=")
+	require.Equal(t, &Integrity{Method: "sha256", Value: "abc="}, integrityFromHeader(h))
+
+	// checksums of multipart uploads are not of the content
+	h.Set("X-Amz-Checksum-Sha256", "abc=-3")
+	require.Nil(t, integrityFromHeader(h))
+	h.Set("Digest", "SHA-512=def=")
+	require.Equal(t, &Integrity{Method: "sha512", Value: "def="}, integrityFromHeader(h))
+}
@@ -0,0 +1,82 @@
+package internal
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// linkKeys are the keys accepted by ParseLink
+var linkKeys = map[string]bool{"href": true, "rel": true, "type": true, "length": true, "integrity": true}
+
+// ParseLink parses an additional notification link as comma separated <key>=<value>
+// pairs, e.g., href=https://mirror/granule.nc,rel=via,length=1024. Keys are:
+//
+//   - href: link URL, required
+//   - rel: link relation, e.g., via, alternate or preview. Defaults to alternate. Only
+//     the notification itself can have the canonical link.
+//   - type: mime-type, determined from the href file name if not provided
+//   - length: content length in bytes
+//   - integrity: <method>:<base64 value> checksum of the content, e.g., sha512:...
+//
+// Commas in the href do not need to be escaped if they are not followed by one of the
+// keys.
+func ParseLink(s string) (Link, error) {
+	values := map[string]string{}
+	var key string
+	for _, part := range strings.Split(s, ",") {
+		k, v, found := strings.Cut(part, "=")
+		k = strings.ToLower(strings.TrimSpace(k))
+		if !found || !linkKeys[k] {
+			if key == "" {
+				return Link{}, fmt.Errorf("invalid link %q, expected <key>=<value> pairs", s)
+			}
+			// part of the previous value
+			values[key] += "," + part
+			continue
+		}
+		if _, ok := values[k]; ok {
+			return Link{}, fmt.Errorf("invalid link %q, duplicate %s", s, k)
+		}
+		key, values[k] = k, v
+	}
+
+	link := Link{Href: strings.TrimSpace(values["href"]), Rel: strings.TrimSpace(values["rel"]), Type: strings.TrimSpace(values["type"])}
+	u, err := url.Parse(link.Href)
+	if link.Href == "" || err != nil || u.Scheme == "" || u.Host == "" {
+		return Link{}, fmt.Errorf("invalid link %q, href must be an absolute url", s)
+	}
+	switch link.Rel {
+	case "":
+		link.Rel = "alternate"
+	case "canonical":
+		return Link{}, fmt.Errorf("invalid link %q, additional links cannot be canonical", s)
+	}
+	if link.Type == "" {
+		link.Type = mimeTypeByExtension(path.Base(u.Path))
+	}
+	if v, ok := values["length"]; ok {
+		link.Length, err = strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+		if err != nil || link.Length < 0 {
+			return Link{}, fmt.Errorf("invalid link %q, length must be a non-negative integer", s)
+		}
+	}
+	if v, ok := values["integrity"]; ok {
+		method, value, found := strings.Cut(strings.TrimSpace(v), ":")
+		if !found {
+			return Link{}, fmt.Errorf("invalid link %q, integrity must be <method>:<value>", s)
+		}
+		h, err := newHash(method)
+		if err != nil {
+			return Link{}, fmt.Errorf("invalid link %q: %w", s, err)
+		}
+		if sum, err := base64.StdEncoding.DecodeString(value); err != nil || len(sum) != h.Size() {
+			return Link{}, fmt.Errorf("invalid link %q, integrity value is not a base64 %s checksum", s, method)
+		}
+		link.Integrity = &Integrity{Method: strings.ToLower(method), Value: value}
+	}
+	return link, nil
+}
@@ -0,0 +1,70 @@
+package internal
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLink(t *testing.T) {
+	sum := sha512b64([]byte("xxx"))
+	cases := []struct {
+		value    string
+		expected Link
+	}{
+		{"href=https://mirror/granule.nc,rel=via,length=1024", Link{Href: "https://mirror/granule.nc", Rel: "via", Type: "application/x-netcdf", Length: 1024}},
+		{"href=https://server/quicklook.png,rel=preview,type=image/png", Link{Href: "https://server/quicklook.png", Rel: "preview", Type: "image/png"}},
+		{"href=https://server/granule.nc.gz,integrity=sha512:" + sum, Link{
+			Href: "https://server/granule.nc.gz", Rel: "alternate", Type: "application/gzip",
+			Integrity: &Integrity{Method: "sha512", Value: sum},
+		}},
+		{"rel=via,href=https://server/a,b.nc", Link{Href: "https://server/a,b.nc", Rel: "via", Type: "application/x-netcdf"}},
+	}
+	for _, test := range cases {
+		link, err := ParseLink(test.value)
+		require.NoError(t, err, test.value)
+		require.Equal(t, test.expected, link, test.value)
+	}
+
+	for _, value := range []string{
+		"https://server/granule.nc",
+		"rel=via",
+		"href=/granule.nc",
+		"href=https://server/granule.nc,rel=canonical",
+		"href=https://server/granule.nc,length=-1",
+		"href=https://server/granule.nc,href=https://other/granule.nc",
+		"href=https://server/granule.nc,integrity=md5:xxx",
+		"href=https://server/granule.nc,integrity=sha512:eHh4",
+	} {
+		_, err := ParseLink(value)
+		require.Error(t, err, value)
+	}
+}
+
+func TestNewNotificationMessageLinks(t *testing.T) {
+	fpath := filepath.Join(t.TempDir(), "granule.nc")
+	require.NoError(t, os.WriteFile(fpath, []byte("xxx"), 0o644))
+	in, err := NewInput(fpath, InputConfig{})
+	require.NoError(t, err)
+
+	downloadURL, _ := url.Parse("https://server/granule.nc")
+	via := Link{Href: "https://mirror/granule.nc", Rel: "via", Type: "application/x-netcdf", Length: 3}
+	opts := NotificationOptions{
+		Topic:       "origin/a/wis2/x/data/core/weather",
+		DownloadURL: downloadURL,
+		Links:       []Link{via},
+	}
+	msg, err := NewNotificationMessage(context.Background(), in, opts)
+	require.NoError(t, err)
+	require.Len(t, msg.Links, 2)
+	require.Equal(t, "canonical", msg.Links[0].Rel)
+	require.Equal(t, via, msg.Links[1])
+
+	opts.Links = []Link{{Href: "https://mirror/granule.nc", Rel: "canonical"}}
+	_, err = NewNotificationMessage(context.Background(), in, opts)
+	require.Error(t, err)
+}
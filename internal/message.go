@@ -1,46 +1,20 @@
 package internal
 
 import (
-	"crypto/sha512"
+	"context"
 	_ "embed"
-	"encoding/base64"
+	"encoding/json"
 	"fmt"
-	"io"
 	"mime"
 	"net/url"
-	"os"
 	"path"
 	"strings"
 	"time"
+	"unicode"
 
 	"github.com/google/uuid"
 )
 
-func init() {
-	for typ, exts := range map[string][]string{
-		"application/bufr": {".bufr", ".bufr.bin"},
-		"application/grib": {".grib", ".grib.bin"},
-	} {
-		for _, ext := range exts {
-			if err := mime.AddExtensionType(ext, typ); err != nil {
-				panic(err)
-			}
-		}
-	}
-}
-
-func checksum(f *os.File) (*Integrity, error) {
-	h := sha512.New()
-	_, err := io.Copy(h, f)
-	if err != nil {
-		return nil, err
-	}
-	return &Integrity{
-		Method: "sha512",
-		Value:  base64.StdEncoding.EncodeToString(h.Sum(nil)),
-	}, nil
-}
-
 func genMessageID() string { return uuid.New().String() }
 
 func getDataID(topic, filename string) (string, error) {
@@ -53,77 +27,208 @@ func getDataID(topic, filename string) (string, error) {
 	return path.Join(parts...), nil
 }
 
-// Get mime type from file name
-// See additional types registered in init
+// ValidateDataID checks a data_id is usable as an identifier, i.e., it is a relative
+// path of non-empty segments without whitespace, control characters, or . and ..
+// segments.
+func ValidateDataID(dataID string) error {
+	if dataID == "" {
+		return fmt.Errorf("data_id is empty")
+	}
+	if i := strings.IndexFunc(dataID, func(r rune) bool { return unicode.IsSpace(r) || unicode.IsControl(r) }); i >= 0 {
+		return fmt.Errorf("data_id %q contains whitespace or control characters", dataID)
+	}
+	for _, part := range strings.Split(dataID, "/") {
+		if part == "" || part == "." || part == ".." {
+			return fmt.Errorf("data_id %q must be a relative path without empty, . or .. segments", dataID)
+		}
+	}
+	return nil
+}
+
+// Get mime type from file name using the registered patterns, falling back to the
+// standard library types by extension.
+// See defaultMimeTypes and AddMimeType
 func mimeTypeByExtension(name string) string {
-	switch {
-	case strings.HasSuffix(name, ".bufr.bin"):
-		name = strings.Replace(name, ".bufr.bin", ".bufr", 1)
-	case strings.HasSuffix(name, ".grib.bin"):
-		name = strings.Replace(name, ".grib.bin", ".grib", 1)
+	if typ := registeredMimeType(name); typ != "" {
+		return typ
 	}
 	ext := path.Ext(name)
 	if ext == "" {
 		// no extension
-		return "application/octet-stream"
+		return octetStream
 	}
 	typ := mime.TypeByExtension(ext)
 	if typ == "" {
 		// unknown mimetype
-		return "application/octet-stream"
+		return octetStream
 	}
 	return typ
 }
 
-func NewNotificationMessage(fpath, topic string, downloadURL *url.URL, mimeType, metaId, start, end string) (*NotificationMsgV04, error) {
-	f, err := os.Open(fpath)
-	if err != nil {
-		return nil, err
+// NotificationOptions are the values used to construct a notification message in
+// addition to those determined from the input.
+type NotificationOptions struct {
+	Topic string
+	// DataID, if set, is used as the data_id instead of the topic, without its first 2
+	// levels, and the input name.
+	DataID string
+	// DownloadURL is where the input can be downloaded from. If nil the input URL is
+	// used, which requires the input to be remote.
+	DownloadURL *url.URL
+	// MimeType of the input. If empty it is determined by file extension.
+	MimeType string
+	MetaID   string
+	// Start and End datetimes. If only Start is set it is used as the datetime.
+	Start, End string
+	Geometry   *Geometry
+	// WigosID is the WIGOS station identifier of the observations, if any
+	WigosID string
+	// Stations, if set, is used to fill in a point geometry from the location of the
+	// WigosID station when a geometry is not provided or extracted.
+	Stations *StationRegistry
+	// NoCache sets the cache property to false so Global Caches do not cache the data
+	NoCache bool
+	// LicenseURL, if set, is added as a license link. It is required for recommended
+	// data.
+	LicenseURL string
+	// Security, if set, is the access control of the download URL. It is only allowed
+	// for recommended data.
+	Security *Security
+	// Links are additional links, e.g., mirrors (via) or other formats (alternate), added
+	// after the canonical link. They cannot be canonical.
+	Links []Link
+	// PubTime, if set, is used as the publication time instead of the current time,
+	// e.g., when replaying or back filling notifications.
+	PubTime time.Time
+	// PubTimePrecision is the precision of the pubtime. If 0 DefaultPubTimePrecision is
+	// used.
+	PubTimePrecision time.Duration
+	// Clock provides the current time for the pubtime. If nil SystemClock is used.
+	Clock Clock
+	// Extractor, if set, is used to fill in the geometry, datetimes, and WIGOS station
+	// identifier from the input content when they are not provided.
+	Extractor Extractor
+}
+
+// NewNotificationMessage constructs a notification for input.
+func NewNotificationMessage(ctx context.Context, input Input, opts NotificationOptions) (*NotificationMsgV04, error) {
+	downloadURL := opts.DownloadURL
+	if downloadURL == nil {
+		downloadURL = input.URL()
+	}
+	if downloadURL == nil {
+		return nil, fmt.Errorf("a download url is required for local inputs")
 	}
 
-	csum, err := checksum(f)
-	if err != nil {
-		return nil, fmt.Errorf("checksumming: %w", err)
+	if opts.DataID != "" {
+		if err := ValidateDataID(opts.DataID); err != nil {
+			return nil, err
+		}
+	}
+	if opts.WigosID != "" {
+		if err := ValidateWigosID(opts.WigosID); err != nil {
+			return nil, err
+		}
 	}
 
-	fi, err := f.Stat()
-	if err != nil {
-		return nil, fmt.Errorf("statting: %w", err)
+	if opts.Extractor != nil && (opts.Geometry == nil || opts.Start == "" || opts.WigosID == "") {
+		extracted, err := extract(ctx, input, opts.Extractor)
+		if err != nil {
+			return nil, fmt.Errorf("extracting from input: %w", err)
+		}
+		if opts.Geometry == nil {
+			opts.Geometry = extracted.Geometry
+		}
+		if opts.Start == "" {
+			opts.Start, opts.End = extracted.Start, extracted.End
+		}
+		if opts.WigosID == "" && ValidateWigosID(extracted.WigosID) == nil {
+			opts.WigosID = extracted.WigosID
+		}
 	}
 
-	dataID, err := getDataID(topic, fi.Name())
+	if opts.Geometry == nil && opts.WigosID != "" {
+		if station, ok := opts.Stations.Lookup(opts.WigosID); ok {
+			opts.Geometry = NewPoint(station.Lon, station.Lat)
+		}
+	}
+
+	if opts.Geometry != nil {
+		if err := opts.Geometry.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid geometry: %w", err)
+		}
+	}
+
+	info, err := input.Info(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("unable to construct data id: %w", err)
+		return nil, err
 	}
 
-	typ := mimeType
+	dataID := opts.DataID
+	if dataID == "" {
+		dataID, err = getDataID(opts.Topic, input.Name())
+		if err != nil {
+			return nil, fmt.Errorf("unable to construct data id: %w", err)
+		}
+	}
+
+	typ := opts.MimeType
 	if typ == "" {
-		typ = mimeTypeByExtension(fpath)
+		typ = mimeTypeByExtension(input.Name())
+	}
+
+	pubTime := opts.PubTime
+	if pubTime.IsZero() {
+		clock := opts.Clock
+		if clock == nil {
+			clock = SystemClock
+		}
+		pubTime = clock()
 	}
 
 	props := NotificationMsgV04Properties{
 		DataID:    dataID,
-		MetaId:    metaId,
-		PubTime:   time.Now().Format("2006-01-02T15:04:05.000000000Z"),
-		Integrity: *csum,
+		MetaId:    opts.MetaID,
+		WigosID:   opts.WigosID,
+		PubTime:   FormatPubTime(pubTime, opts.PubTimePrecision),
+		Integrity: info.Integrity,
+	}
+
+	if opts.Start != "" && opts.End == "" {
+		props.Datetime = opts.Start
+	} else if opts.Start != "" && opts.End != "" {
+		props.StartDatetime = opts.Start
+		props.EndDatetime = opts.End
 	}
 
-	if start != "" && end == "" {
-		props.Datetime = start
-	} else if start != "" && end != "" {
-		props.StartDatetime = start
-		props.EndDatetime = end
+	if opts.NoCache {
+		cache := false
+		props.Cache = &cache
+	}
+
+	links := []Link{
+		{Href: downloadURL.String(), Rel: "canonical", Type: typ, Length: info.Size, Security: opts.Security},
+	}
+	for _, link := range opts.Links {
+		if link.Rel == "canonical" {
+			return nil, fmt.Errorf("only the download url can be the canonical link")
+		}
+		links = append(links, link)
+	}
+	if opts.LicenseURL != "" {
+		links = append(links, Link{Href: opts.LicenseURL, Rel: "license", Type: licenseType(opts.LicenseURL)})
+	}
+	if err := validateDataPolicy(opts.Topic, links); err != nil {
+		return nil, err
 	}
 
 	return &NotificationMsgV04{
 		ID:         genMessageID(),
-		ConformsTo: []string{"http://wis.wmo.int/spec/wnm/1/conf/core"},
+		ConformsTo: []string{WNMConformance},
 		Type:       "Feature",
-		Geometry:   nil,
+		Geometry:   opts.Geometry,
 		Properties: props,
-		Links: []Link{
-			{Href: downloadURL.String(), Rel: "canonical", Type: typ, Length: fi.Size()},
-		},
+		Links:      links,
 	}, nil
 }
 
@@ -132,11 +237,46 @@ type Integrity struct {
 	Value  string `json:"value"`
 }
 
+// licenseType returns the mime type of a license link by the href file extension. A
+// license without an extension, e.g., https://creativecommons.org/licenses/by/4.0/, is
+// a web page.
+func licenseType(href string) string {
+	u, err := url.Parse(href)
+	if err != nil {
+		return "text/html"
+	}
+	if typ := mimeTypeByExtension(path.Base(u.Path)); typ != octetStream {
+		return typ
+	}
+	return "text/html"
+}
+
 type Link struct {
-	Href   string `json:"href"`
-	Rel    string `json:"rel"`
-	Type   string `json:"type"`
-	Length int64  `json:"length"`
+	Href     string    `json:"href"`
+	Rel      string    `json:"rel"`
+	Type     string    `json:"type"`
+	Length   int64     `json:"length,omitempty"`
+	Security *Security `json:"security,omitempty"`
+	// Integrity is the checksum of additional links with different content to the
+	// canonical link
+	Integrity *Integrity `json:"integrity,omitempty"`
+}
+
+// MarshalJSON encodes the link, always including the length of the canonical link, even
+// for empty data, as it is the length of the data.
+func (l Link) MarshalJSON() ([]byte, error) {
+	type link Link
+	if l.Rel != "canonical" {
+		return json.Marshal(link(l))
+	}
+	return json.Marshal(struct {
+		Href      string     `json:"href"`
+		Rel       string     `json:"rel"`
+		Type      string     `json:"type"`
+		Length    int64      `json:"length"`
+		Security  *Security  `json:"security,omitempty"`
+		Integrity *Integrity `json:"integrity,omitempty"`
+	}{l.Href, l.Rel, l.Type, l.Length, l.Security, l.Integrity})
 }
 
 type NotificationMsgV04Properties struct {
@@ -147,13 +287,15 @@ type NotificationMsgV04Properties struct {
 	Datetime      string    `json:"datetime,omitempty"`
 	StartDatetime string    `json:"start_datetime,omitempty"`
 	EndDatetime   string    `json:"end_datetime,omitempty"`
+	WigosID       string    `json:"wigos_station_identifier,omitempty"`
+	Cache         *bool     `json:"cache,omitempty"`
 }
 
 type NotificationMsgV04 struct {
 	ID         string                       `json:"id"`
 	ConformsTo []string                     `json:"conformsTo"`
 	Type       string                       `json:"type"`
-	Geometry   any                          `json:"geometry"`
+	Geometry   *Geometry                    `json:"geometry"`
 	Properties NotificationMsgV04Properties `json:"properties"`
 	Links      []Link                       `json:"links"`
 }
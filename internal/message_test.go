@@ -1,6 +1,11 @@
 package internal
 
-import "testing"
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
 
 func TestMimeType(t *testing.T) {
 	cases := []struct {
@@ -11,6 +16,10 @@ func TestMimeType(t *testing.T) {
 		{"foo.bufr.bin", "application/bufr"},
 		{"foo.grib", "application/grib"},
 		{"foo.grib.bin", "application/grib"},
+		{"foo.grib2", "application/grib"},
+		{"FOO.BUFR", "application/bufr"},
+		{"foo.nc", "application/x-netcdf"},
+		{"foo.h5", "application/x-hdf5"},
 		{"foo", "application/octet-stream"},
 	}
 	for _, test := range cases {
@@ -19,3 +28,29 @@ func TestMimeType(t *testing.T) {
 		}
 	}
 }
+
+func TestValidateDataID(t *testing.T) {
+	for _, id := range []string{"wis2/x/data/core/weather/granule.nc", "granule.nc", "x/2024/01/02/granule-0300.nc"} {
+		require.NoError(t, ValidateDataID(id), id)
+	}
+	for _, id := range []string{"", "/wis2/x/granule.nc", "wis2/x/", "wis2//granule.nc", "wis2/../granule.nc", "wis2/my granule.nc", "wis2/x\ngranule"} {
+		require.Error(t, ValidateDataID(id), id)
+	}
+}
+
+func TestLicenseType(t *testing.T) {
+	require.Equal(t, "text/html", licenseType("https://creativecommons.org/licenses/by/4.0/"))
+	require.Equal(t, "application/pdf", licenseType("https://server/license.pdf"))
+	require.Equal(t, "text/plain; charset=utf-8", licenseType("https://server/LICENSE.txt"))
+}
+
+func TestLinkMarshalJSON(t *testing.T) {
+	// the canonical link always has a length, even for empty data
+	dat, err := json.Marshal(Link{Href: "https://server/empty.txt", Rel: "canonical", Type: "text/plain"})
+	require.NoError(t, err)
+	require.JSONEq(t, `{"href": "https://server/empty.txt", "rel": "canonical", "type": "text/plain", "length": 0}`, string(dat))
+
+	dat, err = json.Marshal(Link{Href: "https://server/preview.png", Rel: "preview", Type: "image/png"})
+	require.NoError(t, err)
+	require.JSONEq(t, `{"href": "https://server/preview.png", "rel": "preview", "type": "image/png"}`, string(dat))
+}
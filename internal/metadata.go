@@ -0,0 +1,151 @@
+package internal
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+const (
+	// WCMP2Conformance is the WMO Core Metadata Profile 2 core conformance class
+	WCMP2Conformance = "http://wis.wmo.int/spec/wcmp/2/conf/core"
+	// WCMP2IDPrefix is the prefix of WCMP2 record identifiers
+	WCMP2IDPrefix = "urn:wmo:md:"
+)
+
+//go:embed schema/wcmp2-bundled.json
+var wcmp2Schema []byte
+
+const wcmp2SchemaURL = "https://schemas.wmo.int/wcmp/2.0/schemas/wcmp2-bundled.json"
+
+var (
+	wcmp2Once     sync.Once
+	wcmp2Compiled *jsonschema.Schema
+	wcmp2Err      error
+)
+
+func compiledWCMP2Schema() (*jsonschema.Schema, error) {
+	wcmp2Once.Do(func() {
+		dat, err := fixWCMP2Schema(wcmp2Schema)
+		if err != nil {
+			wcmp2Err = err
+			return
+		}
+
+		c := jsonschema.NewCompiler()
+		c.Draft = jsonschema.Draft2020
+		if wcmp2Err = c.AddResource(wcmp2SchemaURL, bytes.NewReader(dat)); wcmp2Err != nil {
+			return
+		}
+		wcmp2Compiled, wcmp2Err = c.Compile(wcmp2SchemaURL)
+	})
+	return wcmp2Compiled, wcmp2Err
+}
+
+// fixWCMP2Schema fixes references in the bundled WCMP2 schema that do not resolve. The
+// Link definition keeps the $id of the file it was bundled from, so its references to
+// other definitions resolve against that file, and some references point into the links
+// property as if Link were inlined there.
+func fixWCMP2Schema(dat []byte) ([]byte, error) {
+	var doc map[string]any
+	if err := json.Unmarshal(dat, &doc); err != nil {
+		return nil, err
+	}
+	defs, _ := doc["definitions"].(map[string]any)
+	for _, def := range defs {
+		if def, ok := def.(map[string]any); ok {
+			delete(def, "$id")
+		}
+	}
+	var walk func(v any)
+	walk = func(v any) {
+		switch v := v.(type) {
+		case map[string]any:
+			if ref, ok := v["$ref"].(string); ok {
+				v["$ref"] = strings.Replace(ref, "#/properties/links/items/", "#/definitions/Link/", 1)
+			}
+			for _, item := range v {
+				walk(item)
+			}
+		case []any:
+			for _, item := range v {
+				walk(item)
+			}
+		}
+	}
+	walk(doc)
+	return json.Marshal(doc)
+}
+
+// ValidateMetadata validates a WMO Core Metadata Profile 2 (WCMP2) discovery metadata
+// record against the WCMP2 schema, and checks it conforms to WCMP2 and has a WCMP2
+// identifier. A *ValidationError is returned if there are problems.
+func ValidateMetadata(dat []byte) error {
+	schema, err := compiledWCMP2Schema()
+	if err != nil {
+		return fmt.Errorf("compiling wcmp2 schema: %w", err)
+	}
+
+	var doc any
+	dec := json.NewDecoder(bytes.NewReader(dat))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		return &ValidationError{Kind: "metadata", Problems: []string{fmt.Sprintf("not json: %s", err)}}
+	}
+
+	problems := []string{}
+	var verr *jsonschema.ValidationError
+	if err := schema.Validate(doc); errors.As(err, &verr) {
+		problems = append(problems, schemaProblems(verr)...)
+	} else if err != nil {
+		return err
+	}
+
+	if record, ok := doc.(map[string]any); ok {
+		if id, ok := record["id"].(string); ok && !strings.HasPrefix(id, WCMP2IDPrefix) {
+			problems = append(problems, fmt.Sprintf("id must start with %s", WCMP2IDPrefix))
+		}
+		if conformsTo, ok := record["conformsTo"].([]any); ok && !containsValue(conformsTo, WCMP2Conformance) {
+			problems = append(problems, "conformsTo must include "+WCMP2Conformance)
+		}
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Kind: "metadata", Problems: problems}
+	}
+	return nil
+}
+
+// schemaProblems returns the distinct problems of the innermost causes of a schema
+// validation error, which identify the invalid values.
+func schemaProblems(verr *jsonschema.ValidationError) []string {
+	seen := map[string]bool{}
+	var walk func(e *jsonschema.ValidationError)
+	walk = func(e *jsonschema.ValidationError) {
+		if len(e.Causes) == 0 {
+			loc := e.InstanceLocation
+			if loc == "" {
+				loc = "/"
+			}
+			seen[fmt.Sprintf("%s: %s", loc, e.Message)] = true
+		}
+		for _, cause := range e.Causes {
+			walk(cause)
+		}
+	}
+	walk(verr)
+
+	problems := []string{}
+	for p := range seen {
+		problems = append(problems, p)
+	}
+	sort.Strings(problems)
+	return problems
+}
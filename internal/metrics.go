@@ -0,0 +1,84 @@
+package internal
+
+import (
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metrics are collected by the package regardless of whether they are registered, so
+// long-running commands only need to register them with RegisterMetrics to expose them.
+var (
+	messagesPublished = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "wispub",
+		Name:      "messages_published_total",
+		Help:      "Messages published and acknowledged by the broker.",
+	})
+	publishFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "wispub",
+		Name:      "publish_failures_total",
+		Help:      "Messages that failed to publish, by PUBACK reason code, or none if not acknowledged.",
+	}, []string{"reason_code", "reason"})
+	lastPublished = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "wispub",
+		Name:      "last_published_timestamp_seconds",
+		Help:      "Unix time the last message was published.",
+	})
+	publishDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "wispub",
+		Name:      "publish_duration_seconds",
+		Help:      "Time from sending a message to receiving the PUBACK.",
+		Buckets:   prometheus.ExponentialBuckets(0.005, 2, 12),
+	})
+	publishPending = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "wispub",
+		Name:      "publish_pending",
+		Help:      "Messages being published on the shared broker connection, i.e., waiting for the connection or the PUBACK.",
+	})
+	brokerReconnects = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "wispub",
+		Name:      "broker_reconnects_total",
+		Help:      "Times the broker connection was re-made after being lost.",
+	})
+	checksumBytes = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "wispub",
+		Name:      "checksum_bytes_total",
+		Help:      "Bytes of input checksummed.",
+	})
+	checksumDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "wispub",
+		Name:      "checksum_duration_seconds",
+		Help:      "Time to checksum an input, including reading it.",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 4, 10),
+	})
+)
+
+// RegisterMetrics registers the package metrics with reg
+func RegisterMetrics(reg prometheus.Registerer) error {
+	collectors := []prometheus.Collector{
+		messagesPublished,
+		publishFailures,
+		lastPublished,
+		publishDuration,
+		publishPending,
+		brokerReconnects,
+		checksumBytes,
+		checksumDuration,
+	}
+	for _, c := range collectors {
+		if err := reg.Register(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// countPublishFailure counts a failed publish. reasonCode is the PUBACK reason code, or
+// nil if the message was not acknowledged.
+func countPublishFailure(reasonCode *byte) {
+	if reasonCode == nil {
+		publishFailures.WithLabelValues("none", "not acknowledged").Inc()
+		return
+	}
+	publishFailures.WithLabelValues(strconv.Itoa(int(*reasonCode)), PubReason(*reasonCode)).Inc()
+}
@@ -0,0 +1,70 @@
+package internal
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegisterMetrics(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	require.NoError(t, RegisterMetrics(reg))
+	require.Error(t, RegisterMetrics(reg), "registering twice")
+}
+
+func TestMetrics(t *testing.T) {
+	t.Setenv("WISPUB_BROKER_USER", "user")
+	t.Setenv("WISPUB_BROKER_PASSWD", "passwd")
+	ctx := context.Background()
+
+	t.Run("checksum", func(t *testing.T) {
+		before := testutil.ToFloat64(checksumBytes)
+		_, _, err := digest(strings.NewReader("xxxx"))
+		require.NoError(t, err)
+		require.Equal(t, before+4, testutil.ToFloat64(checksumBytes))
+	})
+
+	t.Run("published", func(t *testing.T) {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer l.Close()
+		serveFakeBroker(t, l, 0, 0)
+		u, _ := url.Parse("tcp://" + l.Addr().String())
+
+		before := testutil.ToFloat64(messagesPublished)
+		_, err = NewPublisher(u, "test", "", false).Publish(ctx, "sandbox/test", []byte(`{}`))
+		require.NoError(t, err)
+		require.Equal(t, before+1, testutil.ToFloat64(messagesPublished))
+		require.NotZero(t, testutil.ToFloat64(lastPublished))
+		require.Zero(t, testutil.ToFloat64(publishPending))
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer l.Close()
+		serveFakeBroker(t, l, 0, 0x87)
+		u, _ := url.Parse("tcp://" + l.Addr().String())
+
+		failures := publishFailures.WithLabelValues("135", "not authorized")
+		before := testutil.ToFloat64(failures)
+		_, err = NewPublisher(u, "test", "", false).Publish(ctx, "sandbox/test", []byte(`{}`))
+		require.Error(t, err)
+		require.Equal(t, before+1, testutil.ToFloat64(failures))
+	})
+
+	t.Run("not connected", func(t *testing.T) {
+		u, _ := url.Parse("tcp://127.0.0.1:1")
+		failures := publishFailures.WithLabelValues("none", "not acknowledged")
+		before := testutil.ToFloat64(failures)
+		_, err := NewPublisher(u, "test", "", false).Publish(ctx, "sandbox/test", []byte(`{}`))
+		require.Error(t, err)
+		require.Equal(t, before+1, testutil.ToFloat64(failures))
+	})
+}
@@ -0,0 +1,145 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"os"
+	"path"
+	"strings"
+	"sync"
+)
+
+// defaultMimeTypes are the file name patterns for types the standard library does not
+// know about, or where WMO prefers a different type.
+var defaultMimeTypes = map[string]string{
+	".bufr":     "application/bufr",
+	".bufr.bin": "application/bufr",
+	".bufr4":    "application/bufr",
+	".grib":     "application/grib",
+	".grib.bin": "application/grib",
+	".grib2":    "application/grib",
+	".grb":      "application/grib",
+	".grb2":     "application/grib",
+	".nc":       "application/x-netcdf",
+	".nc4":      "application/x-netcdf",
+	".h5":       "application/x-hdf5",
+	".hdf5":     "application/x-hdf5",
+	".he5":      "application/x-hdf5",
+	".hdf":      "application/x-hdf",
+	".cap":      "application/cap+xml",
+}
+
+// mimePattern maps file names matching a pattern to a mime type
+type mimePattern struct {
+	pattern string
+	typ     string
+	glob    bool
+	// user patterns take precedence over the defaults
+	user bool
+}
+
+func (p mimePattern) match(name string) bool {
+	if p.glob {
+		ok, _ := path.Match(p.pattern, name)
+		return ok
+	}
+	return strings.HasSuffix(name, p.pattern)
+}
+
+// more specific patterns are preferred
+func (p mimePattern) better(o *mimePattern) bool {
+	if o == nil || p.user != o.user {
+		return o == nil || p.user
+	}
+	if p.glob != o.glob {
+		return p.glob
+	}
+	return len(p.pattern) > len(o.pattern)
+}
+
+var mimeRegistry = struct {
+	sync.RWMutex
+	patterns []mimePattern
+}{}
+
+func init() {
+	for pattern, typ := range defaultMimeTypes {
+		mimeRegistry.patterns = append(mimeRegistry.patterns, newMimePattern(pattern, typ, false))
+	}
+}
+
+func newMimePattern(pattern, typ string, user bool) mimePattern {
+	pattern = strings.ToLower(pattern)
+	glob := strings.ContainsAny(pattern, "*?[")
+	if !glob && !strings.Contains(pattern, ".") {
+		// bare extension, e.g., nc
+		pattern = "." + pattern
+	}
+	return mimePattern{pattern: pattern, typ: typ, glob: glob, user: user}
+}
+
+// AddMimeType registers a mime type for file names matching pattern. The pattern can be
+// an extension or file name suffix, e.g., .nc or .nc.gz, or a glob pattern matching the
+// whole file name, e.g., *_quicklook.png. Patterns are case-insensitive and take
+// precedence over the default types.
+func AddMimeType(pattern, typ string) error {
+	if strings.TrimSpace(pattern) == "" {
+		return fmt.Errorf("empty mime type pattern")
+	}
+	if _, _, err := mime.ParseMediaType(typ); err != nil {
+		return fmt.Errorf("invalid mime type %q for %s: %w", typ, pattern, err)
+	}
+	p := newMimePattern(pattern, typ, true)
+	if p.glob {
+		if _, err := path.Match(p.pattern, ""); err != nil {
+			return fmt.Errorf("invalid mime type pattern %q: %w", pattern, err)
+		}
+	}
+	mimeRegistry.Lock()
+	defer mimeRegistry.Unlock()
+	mimeRegistry.patterns = append(mimeRegistry.patterns, p)
+	return nil
+}
+
+// LoadMimeMap registers the mime types in a JSON file containing an object mapping
+// patterns to types, e.g., {".nc.gz": "application/gzip"}. See AddMimeType.
+func LoadMimeMap(fpath string) error {
+	dat, err := os.ReadFile(fpath)
+	if err != nil {
+		return err
+	}
+	var types map[string]string
+	if err := json.Unmarshal(dat, &types); err != nil {
+		return fmt.Errorf("decoding mime map %s: %w", fpath, err)
+	}
+	return AddMimeTypes(types)
+}
+
+// AddMimeTypes registers all the pattern to type mappings in types. See AddMimeType.
+func AddMimeTypes(types map[string]string) error {
+	for pattern, typ := range types {
+		if err := AddMimeType(pattern, typ); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// registeredMimeType returns the type for the best matching registered pattern, or an
+// empty string if none match.
+func registeredMimeType(name string) string {
+	name = strings.ToLower(path.Base(name))
+	mimeRegistry.RLock()
+	defer mimeRegistry.RUnlock()
+	var best *mimePattern
+	for i, p := range mimeRegistry.patterns {
+		if p.match(name) && p.better(best) {
+			best = &mimeRegistry.patterns[i]
+		}
+	}
+	if best == nil {
+		return ""
+	}
+	return best.typ
+}
@@ -0,0 +1,51 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// resetMimeRegistry restores the registered mime types when the test completes
+func resetMimeRegistry(t *testing.T) {
+	patterns := append([]mimePattern{}, mimeRegistry.patterns...)
+	t.Cleanup(func() { mimeRegistry.patterns = patterns })
+}
+
+func TestLoadMimeMap(t *testing.T) {
+	resetMimeRegistry(t)
+	fpath := filepath.Join(t.TempDir(), "mime.json")
+	require.NoError(t, os.WriteFile(fpath, []byte(`{
+		".nc.gz": "application/gzip",
+		"*_quicklook.png": "image/x-quicklook",
+		"dat": "application/x-test-dat",
+		".bufr.bin": "application/x-bufr"
+	}`), 0o644))
+	require.NoError(t, LoadMimeMap(fpath))
+
+	cases := []struct {
+		path     string
+		expected string
+	}{
+		{"foo.nc.gz", "application/gzip"},
+		{"foo.nc", "application/x-netcdf"},
+		{"foo_quicklook.png", "image/x-quicklook"},
+		{"foo.png", "image/png"},
+		{"foo.DAT", "application/x-test-dat"},
+		// user patterns take precedence over the defaults
+		{"foo.bufr.bin", "application/x-bufr"},
+		{"foo.bufr", "application/bufr"},
+	}
+	for _, test := range cases {
+		require.Equal(t, test.expected, mimeTypeByExtension(test.path), test.path)
+	}
+}
+
+func TestAddMimeTypeInvalid(t *testing.T) {
+	resetMimeRegistry(t)
+	require.Error(t, AddMimeType(".xxx", "not a type"))
+	require.Error(t, AddMimeType("", "text/plain"))
+	require.Error(t, AddMimeType("[.xxx", "text/plain"))
+}
@@ -0,0 +1,131 @@
+package internal
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/batchatco/go-native-netcdf/netcdf"
+	"github.com/batchatco/go-native-netcdf/netcdf/api"
+)
+
+// ExtractNetCDFAttrs extracts the geometry and time window from the ACDD global
+// attributes of a NetCDF classic or NetCDF4/HDF5 file, i.e., geospatial_lat_min,
+// geospatial_lat_max, geospatial_lon_min, geospatial_lon_max, time_coverage_start, and
+// time_coverage_end.
+//
+// Bounding boxes crossing the antimeridian, i.e., where geospatial_lon_min is greater
+// than geospatial_lon_max, are split into a MultiPolygon.
+func ExtractNetCDFAttrs(fpath string) (zult *Extracted, err error) {
+	// the netcdf package panics on some malformed files
+	defer func() {
+		if r := recover(); r != nil {
+			zult, err = nil, fmt.Errorf("reading %s: %v", fpath, r)
+		}
+	}()
+
+	nc, err := netcdf.Open(fpath)
+	if err != nil {
+		return nil, fmt.Errorf("opening %s: %w", fpath, err)
+	}
+	defer nc.Close()
+	attrs := nc.Attributes()
+
+	zult = &Extracted{}
+	for _, name := range []string{"time_coverage_start", "time_coverage_end"} {
+		val, ok := attrs.Get(name)
+		if !ok {
+			continue
+		}
+		s, ok := val.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s is not a string", name)
+		}
+		t, err := ParseTimestamp(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", name, err)
+		}
+		if name == "time_coverage_start" {
+			zult.Start = FormatDatetime(t, time.Second)
+		} else {
+			zult.End = FormatDatetime(t, time.Second)
+		}
+	}
+	switch {
+	case zult.Start == "" && zult.End != "":
+		// an end without a start is not useful
+		zult.End = ""
+	case zult.Start == zult.End:
+		zult.End = ""
+	case zult.End != "" && zult.Start > zult.End:
+		return nil, fmt.Errorf("time_coverage_start is after time_coverage_end")
+	}
+
+	bounds := map[string]float64{}
+	for _, name := range []string{"geospatial_lon_min", "geospatial_lat_min", "geospatial_lon_max", "geospatial_lat_max"} {
+		v, ok, err := numericAttr(attrs, name)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			bounds[name] = v
+		}
+	}
+	if len(bounds) == 4 {
+		west, east := normalizeLon(bounds["geospatial_lon_min"]), normalizeLon(bounds["geospatial_lon_max"])
+		if bounds["geospatial_lon_max"]-bounds["geospatial_lon_min"] >= 360 {
+			west, east = -180, 180
+		}
+		south, north := bounds["geospatial_lat_min"], bounds["geospatial_lat_max"]
+		zult.Geometry, err = boundsGeometry(west, south, east, north)
+		if err != nil {
+			return nil, fmt.Errorf("invalid geospatial bounds: %w", err)
+		}
+	}
+	return zult, nil
+}
+
+// numericAttr returns the value of a numeric or numeric string attribute. Array values
+// use the first element.
+func numericAttr(attrs api.AttributeMap, name string) (float64, bool, error) {
+	val, ok := attrs.Get(name)
+	if !ok {
+		return 0, false, nil
+	}
+	rv := reflect.ValueOf(val)
+	if rv.Kind() == reflect.Slice {
+		if rv.Len() == 0 {
+			return 0, false, nil
+		}
+		rv = rv.Index(0)
+	}
+	switch rv.Kind() {
+	case reflect.Float32:
+		// use the shortest decimal representation rather than the float32 error
+		v, _ := strconv.ParseFloat(strconv.FormatFloat(rv.Float(), 'g', -1, 32), 64)
+		return v, true, nil
+	case reflect.Float64:
+		return rv.Float(), true, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), true, nil
+	case reflect.String:
+		v, err := strconv.ParseFloat(strings.TrimSpace(rv.String()), 64)
+		if err != nil {
+			return 0, false, fmt.Errorf("%s is not numeric: %q", name, rv.String())
+		}
+		return v, true, nil
+	}
+	return 0, false, fmt.Errorf("%s is not numeric", name)
+}
+
+// normalizeLon converts longitudes in the range [0, 360] to [-180, 180]
+func normalizeLon(lon float64) float64 {
+	if lon > 180 && lon <= 360 {
+		return lon - 360
+	}
+	return lon
+}
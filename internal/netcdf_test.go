@@ -0,0 +1,185 @@
+package internal
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/batchatco/go-native-netcdf/netcdf/cdf"
+	"github.com/batchatco/go-native-netcdf/netcdf/util"
+	"github.com/stretchr/testify/require"
+)
+
+func writeNetCDF(t *testing.T, attrs map[string]any) string {
+	fpath := filepath.Join(t.TempDir(), "granule.nc")
+	w, err := cdf.OpenWriter(fpath)
+	require.NoError(t, err)
+	keys := []string{}
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	m, err := util.NewOrderedMap(keys, attrs)
+	require.NoError(t, err)
+	require.NoError(t, w.AddGlobalAttrs(m))
+	require.NoError(t, w.Close())
+	return fpath
+}
+
+func TestExtractNetCDFAttrs(t *testing.T) {
+	t.Run("bbox", func(t *testing.T) {
+		fpath := writeNetCDF(t, map[string]any{
+			"geospatial_lat_min":  float32(20.5),
+			"geospatial_lat_max":  float32(40),
+			"geospatial_lon_min":  float64(-100),
+			"geospatial_lon_max":  "-80",
+			"time_coverage_start": "2024-01-02T03:04:05.5Z",
+			"time_coverage_end":   "2024-01-02T03:09:05Z",
+		})
+		zult, err := ExtractNetCDFAttrs(fpath)
+		require.NoError(t, err)
+		require.Equal(t, NewBBox(-100, 20.5, -80, 40), zult.Geometry)
+		require.Equal(t, "2024-01-02T03:04:05Z", zult.Start)
+		require.Equal(t, "2024-01-02T03:09:05Z", zult.End)
+	})
+
+	t.Run("antimeridian", func(t *testing.T) {
+		fpath := writeNetCDF(t, map[string]any{
+			"geospatial_lat_min": float64(-10),
+			"geospatial_lat_max": float64(10),
+			"geospatial_lon_min": float64(170),
+			"geospatial_lon_max": float64(190),
+		})
+		zult, err := ExtractNetCDFAttrs(fpath)
+		require.NoError(t, err)
+		require.Equal(t, GeometryMultiPolygon, zult.Geometry.Type)
+		require.Equal(t, [][]Ring{
+			{bboxRing(170, -10, 180, 10)},
+			{bboxRing(-180, -10, -170, 10)},
+		}, zult.Geometry.MultiPolygon)
+		require.NoError(t, zult.Geometry.Validate())
+		require.Empty(t, zult.Start)
+	})
+
+	t.Run("single time", func(t *testing.T) {
+		fpath := writeNetCDF(t, map[string]any{
+			"time_coverage_start": "2024-01-02T03:04:05",
+			"time_coverage_end":   "2024-01-02T03:04:05",
+		})
+		zult, err := ExtractNetCDFAttrs(fpath)
+		require.NoError(t, err)
+		require.Nil(t, zult.Geometry)
+		require.Equal(t, "2024-01-02T03:04:05Z", zult.Start)
+		require.Empty(t, zult.End)
+	})
+
+	t.Run("start only", func(t *testing.T) {
+		fpath := writeNetCDF(t, map[string]any{
+			"time_coverage_start": "2024-01-02T03:04:05Z",
+		})
+		zult, err := ExtractNetCDFAttrs(fpath)
+		require.NoError(t, err)
+		require.Equal(t, "2024-01-02T03:04:05Z", zult.Start)
+		require.Empty(t, zult.End)
+	})
+
+	t.Run("no area", func(t *testing.T) {
+		fpath := writeNetCDF(t, map[string]any{
+			"geospatial_lat_min":  float64(20),
+			"geospatial_lat_max":  float64(40),
+			"geospatial_lon_min":  float64(-100),
+			"geospatial_lon_max":  float64(-100),
+			"time_coverage_start": "2024-01-02T03:04:05Z",
+		})
+		zult, err := ExtractNetCDFAttrs(fpath)
+		require.NoError(t, err)
+		require.Nil(t, zult.Geometry)
+		require.Equal(t, "2024-01-02T03:04:05Z", zult.Start)
+
+		fpath = writeNetCDF(t, map[string]any{
+			"geospatial_lat_min": float64(30),
+			"geospatial_lat_max": float64(30),
+			"geospatial_lon_min": float64(-100),
+			"geospatial_lon_max": float64(-80),
+		})
+		zult, err = ExtractNetCDFAttrs(fpath)
+		require.NoError(t, err)
+		require.Nil(t, zult.Geometry)
+
+		fpath = writeNetCDF(t, map[string]any{
+			"geospatial_lat_min": float64(30),
+			"geospatial_lat_max": float64(30),
+			"geospatial_lon_min": float64(-100),
+			"geospatial_lon_max": float64(-100),
+		})
+		zult, err = ExtractNetCDFAttrs(fpath)
+		require.NoError(t, err)
+		require.Equal(t, NewPoint(-100, 30), zult.Geometry)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		fpath := writeNetCDF(t, map[string]any{
+			"time_coverage_start": "2024-01-02T03:04:05Z",
+			"time_coverage_end":   "2024-01-01T03:04:05Z",
+		})
+		_, err := ExtractNetCDFAttrs(fpath)
+		require.Error(t, err)
+
+		fpath = writeNetCDF(t, map[string]any{
+			"geospatial_lat_min": float64(40),
+			"geospatial_lat_max": float64(20),
+			"geospatial_lon_min": float64(-100),
+			"geospatial_lon_max": float64(-80),
+		})
+		_, err = ExtractNetCDFAttrs(fpath)
+		require.Error(t, err)
+
+		fpath = filepath.Join(t.TempDir(), "bogus.nc")
+		require.NoError(t, os.WriteFile(fpath, []byte("not netcdf"), 0o644))
+		_, err = ExtractNetCDFAttrs(fpath)
+		require.Error(t, err)
+	})
+}
+
+func TestNewNotificationMessageExtracted(t *testing.T) {
+	fpath := writeNetCDF(t, map[string]any{
+		"geospatial_lat_min":  float64(20),
+		"geospatial_lat_max":  float64(40),
+		"geospatial_lon_min":  float64(-100),
+		"geospatial_lon_max":  float64(-80),
+		"time_coverage_start": "2024-01-02T03:04:05Z",
+		"time_coverage_end":   "2024-01-02T03:09:05Z",
+	})
+	in, err := NewInput(fpath, InputConfig{})
+	require.NoError(t, err)
+	extractor, err := NewExtractor(ExtractAuto, "application/x-netcdf")
+	require.NoError(t, err)
+	require.NotNil(t, extractor)
+
+	downloadURL, _ := url.Parse("https://server/granule.nc")
+	opts := NotificationOptions{
+		Topic:       "origin/a/wis2/centre/data/core/weather",
+		DownloadURL: downloadURL,
+		Extractor:   extractor,
+	}
+	msg, err := NewNotificationMessage(context.Background(), in, opts)
+	require.NoError(t, err)
+	require.Equal(t, NewBBox(-100, 20, -80, 40), msg.Geometry)
+	require.Equal(t, "2024-01-02T03:04:05Z", msg.Properties.StartDatetime)
+	require.Equal(t, "2024-01-02T03:09:05Z", msg.Properties.EndDatetime)
+
+	// provided values take precedence
+	opts.Geometry = NewPoint(1, 2)
+	opts.Start = "2025-01-01T00:00:00Z"
+	msg, err = NewNotificationMessage(context.Background(), in, opts)
+	require.NoError(t, err)
+	require.Equal(t, NewPoint(1, 2), msg.Geometry)
+	require.Equal(t, "2025-01-01T00:00:00Z", msg.Properties.Datetime)
+
+	extractor, err = NewExtractor(ExtractAuto, "text/plain")
+	require.NoError(t, err)
+	require.Nil(t, extractor)
+	_, err = NewExtractor("bogus", "")
+	require.Error(t, err)
+}
@@ -0,0 +1,108 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	DataPolicyCore        = "core"
+	DataPolicyRecommended = "recommended"
+)
+
+// ValidateTopic checks topic is a WIS2 topic a notification can be published to, i.e.,
+// origin|cache/a/wis2/<centre-id>/data|metadata/..., without wildcards, and data topics
+// have a core or recommended data policy.
+func ValidateTopic(topic string) error {
+	levels := strings.Split(topic, "/")
+	if len(levels) < 5 {
+		return fmt.Errorf("topic %q must be of the form origin/a/wis2/<centre-id>/data|metadata/...", topic)
+	}
+	for i, level := range levels {
+		if level == "" || level == "+" || level == "#" {
+			return fmt.Errorf("topic %q level %d must not be empty or a wildcard", topic, i+1)
+		}
+	}
+	if (levels[0] != "origin" && levels[0] != "cache") || levels[1] != "a" || levels[2] != "wis2" {
+		return fmt.Errorf("topic %q must start with origin/a/wis2 or cache/a/wis2", topic)
+	}
+	switch levels[4] {
+	case "metadata":
+	case "data":
+		if policy := TopicDataPolicy(topic); policy != DataPolicyCore && policy != DataPolicyRecommended {
+			return fmt.Errorf("topic %q data policy must be %s or %s", topic, DataPolicyCore, DataPolicyRecommended)
+		}
+	default:
+		return fmt.Errorf("topic %q notification type must be data or metadata", topic)
+	}
+	return nil
+}
+
+// TopicDataPolicy returns the data policy of a WIS2 data topic, i.e., the level after
+// data in origin/a/wis2/<centre-id>/data/<policy>/..., or an empty string if it is not a
+// data topic.
+func TopicDataPolicy(topic string) string {
+	levels := strings.Split(topic, "/")
+	if len(levels) < 6 || levels[4] != "data" {
+		return ""
+	}
+	return levels[5]
+}
+
+// Security describes the access control of a link to recommended data, using OpenAPI
+// security schemes.
+type Security struct {
+	Default SecurityScheme `json:"default"`
+}
+
+type SecurityScheme struct {
+	Type        string `json:"type"`
+	Scheme      string `json:"scheme,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// securitySchemes are the supported security schemes by name
+var securitySchemes = map[string]SecurityScheme{
+	"basic":         {Type: "http", Scheme: "basic"},
+	"bearer":        {Type: "http", Scheme: "bearer"},
+	"digest":        {Type: "http", Scheme: "digest"},
+	"apikey":        {Type: "apiKey"},
+	"oauth2":        {Type: "oauth2"},
+	"openidconnect": {Type: "openIdConnect"},
+	"mutualtls":     {Type: "mutualTLS"},
+}
+
+// NewSecurity returns the link security for a scheme, one of basic, bearer, digest,
+// apiKey, oauth2, openIdConnect or mutualTLS. The description should tell users how to
+// get access.
+func NewSecurity(scheme, description string) (*Security, error) {
+	s, ok := securitySchemes[strings.ToLower(scheme)]
+	if !ok {
+		return nil, fmt.Errorf("unsupported security scheme %q, expected one of basic, bearer, digest, apiKey, "+
+			"oauth2, openIdConnect or mutualTLS", scheme)
+	}
+	s.Description = description
+	return &Security{Default: s}, nil
+}
+
+// validateDataPolicy checks the links are consistent with the data policy of the topic.
+// Recommended data requires a license link, and core data, which must be freely
+// available, cannot have access control.
+func validateDataPolicy(topic string, links []Link) error {
+	var hasLicense, hasSecurity bool
+	for _, link := range links {
+		hasLicense = hasLicense || link.Rel == "license"
+		hasSecurity = hasSecurity || link.Security != nil
+	}
+	switch TopicDataPolicy(topic) {
+	case DataPolicyRecommended:
+		if !hasLicense {
+			return fmt.Errorf("recommended data requires a license link")
+		}
+	case DataPolicyCore:
+		if hasSecurity {
+			return fmt.Errorf("core data cannot have access control, use a data/recommended topic")
+		}
+	}
+	return nil
+}
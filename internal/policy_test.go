@@ -0,0 +1,93 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTopicDataPolicy(t *testing.T) {
+	require.Equal(t, DataPolicyCore, TopicDataPolicy("origin/a/wis2/x/data/core/weather"))
+	require.Equal(t, DataPolicyRecommended, TopicDataPolicy("cache/a/wis2/x/data/recommended/weather"))
+	require.Empty(t, TopicDataPolicy("origin/a/wis2/x/metadata"))
+	require.Empty(t, TopicDataPolicy("origin/a/wis2"))
+}
+
+func TestValidateTopic(t *testing.T) {
+	for _, topic := range []string{
+		"origin/a/wis2/us-ssec/data/core/weather/surface-based-observations/synop",
+		"cache/a/wis2/us-ssec/data/recommended/weather",
+		"origin/a/wis2/us-ssec/metadata",
+	} {
+		require.NoError(t, ValidateTopic(topic), topic)
+	}
+	for _, topic := range []string{
+		"",
+		"origin/a/wis2/us-ssec",
+		"origin/a/wis2/+/data/core/weather",
+		"origin/a/wis2/us-ssec/data/core/weather/#",
+		"origin/a/wis2//data/core/weather",
+		"origin/b/wis2/us-ssec/data/core/weather",
+		"origin/a/wis2/us-ssec/data/free/weather",
+		"origin/a/wis2/us-ssec/reports/core/weather",
+	} {
+		require.Error(t, ValidateTopic(topic), topic)
+	}
+}
+
+func TestNewSecurity(t *testing.T) {
+	sec, err := NewSecurity("Bearer", "Contact us")
+	require.NoError(t, err)
+	dat, err := json.Marshal(sec)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"default": {"type": "http", "scheme": "bearer", "description": "Contact us"}}`, string(dat))
+
+	sec, err = NewSecurity("apiKey", "")
+	require.NoError(t, err)
+	require.Equal(t, SecurityScheme{Type: "apiKey"}, sec.Default)
+
+	_, err = NewSecurity("password", "")
+	require.Error(t, err)
+}
+
+func TestNewNotificationMessageDataPolicy(t *testing.T) {
+	fpath := filepath.Join(t.TempDir(), "granule.dat")
+	require.NoError(t, os.WriteFile(fpath, []byte("xxx"), 0o644))
+	in, err := NewInput(fpath, InputConfig{})
+	require.NoError(t, err)
+	security, err := NewSecurity("basic", "")
+	require.NoError(t, err)
+
+	downloadURL, _ := url.Parse("https://server/granule.dat")
+	opts := NotificationOptions{
+		Topic:       "origin/a/wis2/x/data/recommended/weather",
+		DownloadURL: downloadURL,
+		Security:    security,
+		NoCache:     true,
+	}
+	_, err = NewNotificationMessage(context.Background(), in, opts)
+	require.Error(t, err)
+
+	opts.LicenseURL = "https://server/license.html"
+	msg, err := NewNotificationMessage(context.Background(), in, opts)
+	require.NoError(t, err)
+	require.Len(t, msg.Links, 2)
+	require.Equal(t, security, msg.Links[0].Security)
+	require.Equal(t, Link{Href: "https://server/license.html", Rel: "license", Type: "text/html; charset=utf-8"}, msg.Links[1])
+	require.NotNil(t, msg.Properties.Cache)
+	require.False(t, *msg.Properties.Cache)
+
+	opts.Topic = "origin/a/wis2/x/data/core/weather"
+	_, err = NewNotificationMessage(context.Background(), in, opts)
+	require.Error(t, err)
+
+	opts.Security, opts.NoCache = nil, false
+	msg, err = NewNotificationMessage(context.Background(), in, opts)
+	require.NoError(t, err)
+	require.Nil(t, msg.Properties.Cache)
+}
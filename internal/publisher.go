@@ -0,0 +1,168 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/eclipse/paho.golang/paho"
+)
+
+// Publisher publishes messages over a single persistent broker connection shared by
+// concurrent callers. The connection is made on first use, and re-made when it is lost.
+type Publisher struct {
+	broker   *url.URL
+	clientID string
+	tlsCA    string
+	insecure bool
+
+	// connectMu serializes connecting so concurrent callers share one new connection
+	connectMu sync.Mutex
+	// mu guards conn and connected, and is only held to get or replace the connection so
+	// publishes are concurrent
+	mu   sync.Mutex
+	conn *publisherConn
+	// connected is whether a connection has been made, so later connections are counted
+	// as reconnects
+	connected bool
+}
+
+// publisherConn is a broker connection of a Publisher
+type publisherConn struct {
+	client *paho.Client
+	// lost is closed when the connection is lost
+	lost     chan struct{}
+	lostOnce sync.Once
+}
+
+func (c *publisherConn) markLost() { c.lostOnce.Do(func() { close(c.lost) }) }
+
+func (c *publisherConn) isLost() bool {
+	select {
+	case <-c.lost:
+		return true
+	default:
+		return false
+	}
+}
+
+// NewPublisher returns a Publisher for broker. Call Connect to connect before first use,
+// or the connection is made by the first Publish.
+func NewPublisher(broker *url.URL, clientID, tlsCA string, insecure bool) *Publisher {
+	return &Publisher{broker: broker, clientID: clientID, tlsCA: tlsCA, insecure: insecure}
+}
+
+// Connect connects to the broker if not already connected.
+func (p *Publisher) Connect(ctx context.Context) error {
+	_, err := p.connect(ctx)
+	return err
+}
+
+// current returns the current connection, or nil if not connected
+func (p *Publisher) current() *publisherConn {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.conn == nil || p.conn.isLost() {
+		return nil
+	}
+	return p.conn
+}
+
+// connect returns the current connection, connecting if required
+func (p *Publisher) connect(ctx context.Context) (*publisherConn, error) {
+	if conn := p.current(); conn != nil {
+		return conn, nil
+	}
+	p.connectMu.Lock()
+	defer p.connectMu.Unlock()
+	// another caller may have connected while waiting
+	if conn := p.current(); conn != nil {
+		return conn, nil
+	}
+
+	conn := &publisherConn{lost: make(chan struct{})}
+	client, err := newClient(ctx, p.broker, p.tlsCA, p.insecure, paho.ClientConfig{
+		ClientID:           p.clientID,
+		OnClientError:      func(error) { conn.markLost() },
+		OnServerDisconnect: func(*paho.Disconnect) { conn.markLost() },
+	})
+	if err != nil {
+		return nil, err
+	}
+	conn.client = client
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.connected {
+		brokerReconnects.Inc()
+	}
+	p.conn, p.connected = conn, true
+	return conn, nil
+}
+
+// Connected returns whether the publisher has a connection to the broker.
+func (p *Publisher) Connected() bool {
+	return p.current() != nil
+}
+
+// Publish publishes payload to topic with QoS 1, connecting first if not connected. If
+// publishing fails because the connection was lost it is retried once on a new
+// connection. The response is returned if the broker acknowledged the message, including
+// when it was rejected, in which case an error is also returned.
+func (p *Publisher) Publish(ctx context.Context, topic string, payload []byte) (*paho.PublishResponse, error) {
+	publishPending.Inc()
+	defer publishPending.Dec()
+	var resp *paho.PublishResponse
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		var conn *publisherConn
+		conn, err = p.connect(ctx)
+		if err != nil {
+			countPublishFailure(nil)
+			return nil, err
+		}
+		start := time.Now()
+		resp, err = conn.client.Publish(ctx, &paho.Publish{
+			QoS:   QosAtLeastOnce,
+			Topic: topic,
+			Properties: &paho.PublishProperties{
+				ContentType: "application/json",
+			},
+			Payload: payload,
+		})
+		if resp != nil {
+			publishDuration.Observe(time.Since(start).Seconds())
+		}
+		if err == nil || resp != nil || ctx.Err() != nil {
+			break
+		}
+		// not acknowledged, so assume the connection is broken
+		conn.markLost()
+		conn.client.Disconnect(&paho.Disconnect{ReasonCode: 0})
+	}
+	if err != nil {
+		if resp != nil {
+			countPublishFailure(&resp.ReasonCode)
+		} else {
+			countPublishFailure(nil)
+		}
+		return resp, fmt.Errorf("publishing failed: %w", err)
+	}
+	messagesPublished.Inc()
+	lastPublished.SetToCurrentTime()
+	return resp, nil
+}
+
+// Close disconnects from the broker, if connected.
+func (p *Publisher) Close() error {
+	p.mu.Lock()
+	conn := p.conn
+	p.conn = nil
+	p.mu.Unlock()
+	if conn == nil || conn.isLost() {
+		return nil
+	}
+	return conn.client.Disconnect(&paho.Disconnect{ReasonCode: 0})
+}
@@ -0,0 +1,103 @@
+package internal
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/eclipse/paho.golang/packets"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPublisher(t *testing.T) {
+	t.Setenv("WISPUB_BROKER_USER", "user")
+	t.Setenv("WISPUB_BROKER_PASSWD", "passwd")
+	ctx := context.Background()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	serveFakeBroker(t, l, 0, 0)
+
+	u, _ := url.Parse("tcp://" + l.Addr().String())
+	p := NewPublisher(u, "test", "", false)
+	require.False(t, p.Connected())
+	resp, err := p.Publish(ctx, "sandbox/test", []byte(`{}`))
+	require.NoError(t, err)
+	require.Equal(t, byte(0), resp.ReasonCode)
+	require.True(t, p.Connected())
+
+	// the connection is re-made after it is lost
+	reconnects := testutil.ToFloat64(brokerReconnects)
+	p.current().client.Conn.Close()
+	resp, err = p.Publish(ctx, "sandbox/test", []byte(`{}`))
+	require.NoError(t, err)
+	require.Equal(t, byte(0), resp.ReasonCode)
+	require.True(t, p.Connected())
+	require.Equal(t, reconnects+1, testutil.ToFloat64(brokerReconnects))
+}
+
+func TestPublisherConcurrent(t *testing.T) {
+	t.Setenv("WISPUB_BROKER_USER", "user")
+	t.Setenv("WISPUB_BROKER_PASSWD", "passwd")
+
+	// a broker that accepts the connection but never acknowledges publishes
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			pkt, err := packets.ReadPacket(conn)
+			if err != nil {
+				return
+			}
+			if _, ok := pkt.Content.(*packets.Connect); ok {
+				resp := packets.NewControlPacket(packets.CONNACK)
+				resp.WriteTo(conn)
+			}
+		}
+	}()
+
+	u, _ := url.Parse("tcp://" + l.Addr().String())
+	p := NewPublisher(u, "test", "", false)
+	require.NoError(t, p.Connect(context.Background()))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := p.Publish(ctx, "sandbox/test", []byte(`{}`))
+			errs <- err
+		}()
+	}
+
+	// both publishes are pending until acknowledged
+	require.Eventually(t, func() bool {
+		return testutil.ToFloat64(publishPending) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// a stuck publish does not block checking the connection
+	done := make(chan bool)
+	go func() { done <- p.Connected() }()
+	select {
+	case connected := <-done:
+		require.True(t, connected)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Connected blocked by a pending publish")
+	}
+
+	cancel()
+	for i := 0; i < 2; i++ {
+		require.Error(t, <-errs)
+	}
+	require.Zero(t, testutil.ToFloat64(publishPending))
+}
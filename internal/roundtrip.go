@@ -0,0 +1,73 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/eclipse/paho.golang/paho"
+)
+
+// RoundTrip waits for a published notification to be received back from a broker, e.g.,
+// a Global Broker, confirming it was routed and not only accepted by the broker it was
+// published to. Messages are matched by their id.
+type RoundTrip struct {
+	id     string
+	seen   chan time.Time
+	once   sync.Once
+	client *paho.Client
+}
+
+// NewRoundTrip returns a RoundTrip for the notification with message id. Call Subscribe
+// before publishing the message.
+func NewRoundTrip(id string) *RoundTrip {
+	return &RoundTrip{id: id, seen: make(chan time.Time, 1)}
+}
+
+// Subscribe connects to broker and subscribes to topic, which may be a filter, so
+// messages received can be matched.
+func (r *RoundTrip) Subscribe(ctx context.Context, broker *url.URL, clientID, tlsCA string, insecure bool, topic string) error {
+	client, err := NewSubscriber(ctx, broker, clientID, tlsCA, insecure, r.Handle)
+	if err != nil {
+		return err
+	}
+	r.client = client
+	return Subscribe(ctx, client, QosAtLeastOnce, topic)
+}
+
+// Handle checks whether a received message is the notification being waited for.
+func (r *RoundTrip) Handle(p *paho.Publish) {
+	var msg struct {
+		ID string `json:"id"`
+	}
+	if json.Unmarshal(p.Payload, &msg) != nil || msg.ID != r.id {
+		return
+	}
+	r.once.Do(func() { r.seen <- time.Now() })
+}
+
+// Wait waits up to timeout for the notification to be received and returns the latency
+// since it was published.
+func (r *RoundTrip) Wait(ctx context.Context, published time.Time, timeout time.Duration) (time.Duration, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case t := <-r.seen:
+		return t.Sub(published), nil
+	case <-timer.C:
+		return 0, fmt.Errorf("message %s not received within %s", r.id, timeout)
+	case <-ctx.Done():
+		return 0, fmt.Errorf("waiting for message %s: %w", r.id, ctx.Err())
+	}
+}
+
+// Close disconnects the subscriber, if connected.
+func (r *RoundTrip) Close() error {
+	if r.client == nil {
+		return nil
+	}
+	return r.client.Disconnect(&paho.Disconnect{ReasonCode: 0})
+}
@@ -0,0 +1,38 @@
+package internal
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/eclipse/paho.golang/paho"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	published := time.Now()
+
+	rt := NewRoundTrip("6f7a9b2e-5f0c-4c1e-9a3d-2b8e4f6a1c3d")
+	rt.Handle(&paho.Publish{Payload: []byte(`not json`)})
+	rt.Handle(&paho.Publish{Payload: []byte(`{"id": "other"}`)})
+	_, err := rt.Wait(ctx, published, 10*time.Millisecond)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "not received within")
+
+	// received more than once, e.g., via multiple subscriptions
+	go func() {
+		for i := 0; i < 2; i++ {
+			rt.Handle(&paho.Publish{Payload: []byte(`{"id": "6f7a9b2e-5f0c-4c1e-9a3d-2b8e4f6a1c3d"}`)})
+		}
+	}()
+	latency, err := rt.Wait(ctx, published, time.Second)
+	require.NoError(t, err)
+	require.Greater(t, latency, time.Duration(0))
+	require.NoError(t, rt.Close())
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = NewRoundTrip("id").Wait(cancelled, published, time.Second)
+	require.ErrorIs(t, err, context.Canceled)
+}
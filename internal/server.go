@@ -0,0 +1,459 @@
+package internal
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eclipse/paho.golang/paho"
+)
+
+// MessagePublisher publishes encoded messages, e.g., a *Publisher
+type MessagePublisher interface {
+	Publish(ctx context.Context, topic string, payload []byte) (*paho.PublishResponse, error)
+	Connected() bool
+}
+
+// ServerConfig configures the HTTP API server
+type ServerConfig struct {
+	Publisher MessagePublisher
+	// Token is the bearer token required for API requests. If empty all API requests
+	// are refused.
+	Token string
+	// History, if set, is checked for data_id conflicts, updated with published
+	// notifications and served by the history endpoint.
+	History *History
+	Input   InputConfig
+	// InputDirs are the directories local inputs must be in. Local inputs are refused if
+	// there are none.
+	InputDirs []string
+	// Logger logs publications. If nil slog.Default() is used.
+	Logger *slog.Logger
+}
+
+// maxStatuses is the number of recent publication statuses kept by the server
+const maxStatuses = 10000
+
+// maxRequestSize is the maximum size of a publish request body
+const maxRequestSize = 1 << 20
+
+// PublishRequest is the body of a publish request. Either Message, a complete
+// notification message, or Input, the path or URL of the data to generate a
+// notification for, is required. The other fields are used with Input and correspond
+// to the data command flags.
+type PublishRequest struct {
+	Topic   string          `json:"topic"`
+	Message json.RawMessage `json:"message,omitempty"`
+
+	Input       string          `json:"input,omitempty"`
+	DownloadURL string          `json:"download_url,omitempty"`
+	MetadataID  string          `json:"metadata_id,omitempty"`
+	DataID      string          `json:"data_id,omitempty"`
+	Datetime    string          `json:"datetime,omitempty"`
+	MimeType    string          `json:"mime_type,omitempty"`
+	WigosID     string          `json:"wigos_station_identifier,omitempty"`
+	Geometry    json.RawMessage `json:"geometry,omitempty"`
+	NoCache     bool            `json:"no_cache,omitempty"`
+	Links       []Link          `json:"links,omitempty"`
+	// Properties are additional message properties. They cannot overwrite properties
+	// defined by the specification.
+	Properties map[string]any `json:"properties,omitempty"`
+}
+
+// PublicationStatus is the result of a publish request
+type PublicationStatus struct {
+	// ID is the notification message id
+	ID     string `json:"id"`
+	Topic  string `json:"topic"`
+	DataID string `json:"data_id"`
+	// Status is published or failed
+	Status string `json:"status"`
+	// ReasonCode is the PUBACK reason code, if the broker acknowledged the message
+	ReasonCode *byte     `json:"reason_code,omitempty"`
+	Reason     string    `json:"reason,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Warnings   []string  `json:"warnings,omitempty"`
+	Time       time.Time `json:"time"`
+}
+
+const (
+	StatusPublished = "published"
+	StatusFailed    = "failed"
+)
+
+// errorResponse is the body of an error response
+type errorResponse struct {
+	Error    string   `json:"error"`
+	Problems []string `json:"problems,omitempty"`
+}
+
+// Server is an HTTP API for publishing notifications over a shared broker connection.
+//
+// Endpoints:
+//
+//	GET  /healthz                 the server is running
+//	GET  /readyz                  the server is connected to the broker
+//	POST /v1/notifications        publish a PublishRequest
+//	GET  /v1/notifications        recent publication statuses
+//	GET  /v1/notifications/{id}   the status of a publication by message id
+//	GET  /v1/history?data_id=...  the history record of a data_id
+//
+// The /v1 endpoints require the configured bearer token.
+type Server struct {
+	cfg ServerConfig
+
+	mu       sync.Mutex
+	statuses map[string]*PublicationStatus
+	// order is the ids of statuses, oldest first
+	order []string
+}
+
+// NewServer returns a Server with configuration cfg
+func NewServer(cfg ServerConfig) *Server {
+	if cfg.Logger == nil {
+		cfg.Logger = slog.Default()
+	}
+	return &Server{cfg: cfg, statuses: map[string]*PublicationStatus{}}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Path
+	switch {
+	case path == "/healthz":
+		if allowMethod(w, r, http.MethodGet) {
+			writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+		}
+		return
+	case path == "/readyz":
+		if !allowMethod(w, r, http.MethodGet) {
+			return
+		}
+		if !s.cfg.Publisher.Connected() {
+			writeJSON(w, http.StatusServiceUnavailable, map[string]string{"status": "not connected"})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ready"})
+		return
+	case !strings.HasPrefix(path, "/v1/"):
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	if !s.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="wispub"`)
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	switch {
+	case path == "/v1/notifications":
+		if r.Method == http.MethodPost {
+			s.publish(w, r)
+		} else if allowMethod(w, r, http.MethodGet, http.MethodPost) {
+			writeJSON(w, http.StatusOK, s.recentStatuses())
+		}
+	case strings.HasPrefix(path, "/v1/notifications/"):
+		if allowMethod(w, r, http.MethodGet) {
+			s.status(w, strings.TrimPrefix(path, "/v1/notifications/"))
+		}
+	case path == "/v1/history":
+		if allowMethod(w, r, http.MethodGet) {
+			s.history(w, r)
+		}
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+func (s *Server) authorized(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || s.cfg.Token == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(s.cfg.Token)) == 1
+}
+
+func (s *Server) publish(w http.ResponseWriter, r *http.Request) {
+	req := PublishRequest{}
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestSize))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid request: %s", err))
+		return
+	}
+	if err := ValidateTopic(req.Topic); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var payload []byte
+	var err error
+	switch {
+	case len(req.Message) > 0 && req.Input != "":
+		writeError(w, http.StatusBadRequest, "only one of message or input may be used")
+		return
+	case len(req.Message) > 0:
+		payload = req.Message
+	case req.Input != "":
+		payload, err = s.newMessage(r.Context(), req)
+		if err != nil {
+			writeError(w, http.StatusUnprocessableEntity, err.Error())
+			return
+		}
+	default:
+		writeError(w, http.StatusBadRequest, "message or input is required")
+		return
+	}
+
+	msg, problems, warnings := checkPayload(r.Context(), payload, req.Topic)
+	if len(problems) > 0 {
+		writeJSON(w, http.StatusUnprocessableEntity, errorResponse{Error: "invalid notification", Problems: problems})
+		return
+	}
+
+	status := &PublicationStatus{ID: msg.ID, Topic: req.Topic, DataID: msg.Properties.DataID, Warnings: warnings}
+	if s.cfg.History != nil {
+		if prev, ok := s.cfg.History.Conflict(msg.Properties.DataID, msg.Properties.Integrity); ok {
+			status.Warnings = append(status.Warnings,
+				fmt.Sprintf("data_id %s was published at %s with different content", prev.DataID, prev.PubTime))
+		}
+	}
+
+	resp, err := s.cfg.Publisher.Publish(r.Context(), req.Topic, payload)
+	status.Time = time.Now().UTC()
+	if resp != nil {
+		code := resp.ReasonCode
+		status.ReasonCode = &code
+		status.Reason = PubReason(code)
+	}
+	code := http.StatusCreated
+	if err != nil {
+		status.Status = StatusFailed
+		status.Error = err.Error()
+		code = http.StatusBadGateway
+	} else {
+		status.Status = StatusPublished
+		if s.cfg.History != nil {
+			rec := HistoryRecord{DataID: msg.Properties.DataID, PubTime: msg.Properties.PubTime, Integrity: msg.Properties.Integrity}
+			if err := s.cfg.History.Add(rec); err != nil {
+				status.Warnings = append(status.Warnings, fmt.Sprintf("failed to update history: %s", err))
+			}
+		}
+	}
+	s.addStatus(status)
+	s.logStatus(status)
+	writeJSON(w, code, status)
+}
+
+// newMessage generates the encoded notification for a request with an input
+func (s *Server) newMessage(ctx context.Context, req PublishRequest) ([]byte, error) {
+	input, err := NewInput(req.Input, s.cfg.Input)
+	if err != nil {
+		return nil, fmt.Errorf("invalid input: %w", err)
+	}
+	if input.URL() == nil {
+		if len(s.cfg.InputDirs) == 0 {
+			return nil, fmt.Errorf("local inputs are not allowed, no input directories are configured")
+		}
+		if !s.inputAllowed(req.Input) {
+			return nil, fmt.Errorf("input %s is not in an allowed directory", req.Input)
+		}
+	}
+
+	opts := NotificationOptions{
+		Topic:    req.Topic,
+		DataID:   req.DataID,
+		MimeType: req.MimeType,
+		MetaID:   req.MetadataID,
+		WigosID:  req.WigosID,
+		NoCache:  req.NoCache,
+		Links:    req.Links,
+	}
+	if req.DownloadURL != "" {
+		opts.DownloadURL, err = url.Parse(req.DownloadURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid download_url: %w", err)
+		}
+	}
+	if req.Datetime != "" {
+		opts.Start, opts.End, err = ParseDatetime(req.Datetime)
+		if err != nil {
+			return nil, fmt.Errorf("invalid datetime: %w", err)
+		}
+	}
+	if len(req.Geometry) > 0 {
+		// only inline geometries, as ParseGeometry reads other values from files
+		if req.Geometry[0] != '{' {
+			return nil, fmt.Errorf("invalid geometry: must be a GeoJSON object")
+		}
+		opts.Geometry, err = ParseGeometry(string(req.Geometry))
+		if err != nil {
+			return nil, fmt.Errorf("invalid geometry: %w", err)
+		}
+	}
+	if opts.MimeType == "" {
+		opts.MimeType, err = DetectMimeType(ctx, input, MimeDetectAuto)
+		if err != nil {
+			return nil, fmt.Errorf("failed to determine mime-type: %w", err)
+		}
+	}
+
+	msg, err := NewNotificationMessage(ctx, input, opts)
+	if err != nil {
+		return nil, err
+	}
+	return EncodeMessage(msg, req.Properties, false)
+}
+
+// inputAllowed returns whether the local input fpath is in one of the allowed input
+// directories. Symlinks are resolved so they cannot point outside the directories.
+func (s *Server) inputAllowed(fpath string) bool {
+	abs, err := resolvePath(fpath)
+	if err != nil {
+		return false
+	}
+	for _, dir := range s.cfg.InputDirs {
+		dir, err := resolvePath(dir)
+		if err != nil {
+			continue
+		}
+		if rel, err := filepath.Rel(dir, abs); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolvePath returns the absolute path of fpath with symlinks resolved
+func resolvePath(fpath string) (string, error) {
+	fpath, err := filepath.EvalSymlinks(fpath)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Abs(fpath)
+}
+
+// checkPayload validates an encoded notification and checks it is consistent with
+// topic, returning the decoded message and any warnings if there are no problems.
+func checkPayload(ctx context.Context, payload []byte, topic string) (*NotificationMsgV04, []string, []string) {
+	var verr *ValidationError
+	if err := ValidateNotification(payload); errors.As(err, &verr) {
+		return nil, verr.Problems, nil
+	} else if err != nil {
+		return nil, []string{err.Error()}, nil
+	}
+	msg, err := DecodeNotification(payload)
+	if err != nil {
+		return nil, []string{err.Error()}, nil
+	}
+	problems, warnings := CheckNotification(ctx, msg, NotificationChecks{Topic: topic})
+	if len(problems) > 0 {
+		return nil, problems, nil
+	}
+	return msg, nil, warnings
+}
+
+func (s *Server) logStatus(status *PublicationStatus) {
+	attrs := []any{"topic", status.Topic, "data_id", status.DataID, "message_id", status.ID}
+	if status.ReasonCode != nil {
+		attrs = append(attrs, "reason_code", *status.ReasonCode)
+	}
+	for _, warning := range status.Warnings {
+		s.cfg.Logger.Warn(warning, attrs...)
+	}
+	if status.Status == StatusFailed {
+		s.cfg.Logger.Error("publishing failed", append(attrs, "error", status.Error)...)
+		return
+	}
+	s.cfg.Logger.Info("published message", attrs...)
+}
+
+func (s *Server) addStatus(status *PublicationStatus) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.statuses[status.ID]; !ok {
+		s.order = append(s.order, status.ID)
+	}
+	s.statuses[status.ID] = status
+	for len(s.order) > maxStatuses {
+		delete(s.statuses, s.order[0])
+		s.order = s.order[1:]
+	}
+}
+
+// recentStatuses returns the publication statuses, most recent first
+func (s *Server) recentStatuses() []*PublicationStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	statuses := make([]*PublicationStatus, 0, len(s.order))
+	for i := len(s.order) - 1; i >= 0; i-- {
+		statuses = append(statuses, s.statuses[s.order[i]])
+	}
+	return statuses
+}
+
+func (s *Server) status(w http.ResponseWriter, id string) {
+	s.mu.Lock()
+	status, ok := s.statuses[id]
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("no publication with id %s", id))
+		return
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+func (s *Server) history(w http.ResponseWriter, r *http.Request) {
+	if s.cfg.History == nil {
+		writeError(w, http.StatusNotFound, "history is not enabled")
+		return
+	}
+	dataID := r.URL.Query().Get("data_id")
+	if dataID == "" {
+		writeError(w, http.StatusBadRequest, "data_id is required")
+		return
+	}
+	rec, ok := s.cfg.History.Lookup(dataID)
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("data_id %s has not been published", dataID))
+		return
+	}
+	writeJSON(w, http.StatusOK, rec)
+}
+
+// allowMethod returns whether the request method is one of methods, otherwise it
+// responds with 405.
+func allowMethod(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+	for _, m := range methods {
+		if r.Method == m {
+			return true
+		}
+	}
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	return false
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	dat, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(append(dat, '\n'))
+}
+
+func writeError(w http.ResponseWriter, code int, msg string) {
+	writeJSON(w, code, errorResponse{Error: msg})
+}
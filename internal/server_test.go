@@ -0,0 +1,200 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/eclipse/paho.golang/paho"
+	"github.com/stretchr/testify/require"
+)
+
+type fakePublisher struct {
+	connected  bool
+	reasonCode byte
+	published  map[string][]byte
+}
+
+func (p *fakePublisher) Publish(_ context.Context, topic string, payload []byte) (*paho.PublishResponse, error) {
+	resp := &paho.PublishResponse{ReasonCode: p.reasonCode}
+	if p.reasonCode >= 0x80 {
+		return resp, fmt.Errorf("publishing failed: %s", PubReason(p.reasonCode))
+	}
+	p.published[topic] = payload
+	return resp, nil
+}
+
+func (p *fakePublisher) Connected() bool { return p.connected }
+
+func TestServer(t *testing.T) {
+	dir := t.TempDir()
+	fpath := filepath.Join(dir, "granule.nc")
+	require.NoError(t, os.WriteFile(fpath, []byte("xxx"), 0o644))
+	history, err := OpenHistory(filepath.Join(dir, "history.jsonl"))
+	require.NoError(t, err)
+
+	pub := &fakePublisher{connected: true, published: map[string][]byte{}}
+	srv := httptest.NewServer(NewServer(ServerConfig{
+		Publisher: pub,
+		Token:     "secret",
+		History:   history,
+		InputDirs: []string{dir},
+	}))
+	defer srv.Close()
+
+	do := func(method, path, token string, body any) (*http.Response, map[string]any) {
+		t.Helper()
+		var r *bytes.Reader
+		if body != nil {
+			dat, err := json.Marshal(body)
+			require.NoError(t, err)
+			r = bytes.NewReader(dat)
+		} else {
+			r = bytes.NewReader(nil)
+		}
+		req, err := http.NewRequest(method, srv.URL+path, r)
+		require.NoError(t, err)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		result := map[string]any{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+		return resp, result
+	}
+
+	topic := "origin/a/wis2/us-test/data/core/weather"
+	input := PublishRequest{
+		Topic:       topic,
+		Input:       fpath,
+		DownloadURL: "https://server/granule.nc",
+		Datetime:    "2024-01-02T03:04:05Z",
+		Geometry:    json.RawMessage(`{"type": "Point", "coordinates": [-89.4, 43.1]}`),
+	}
+
+	t.Run("health", func(t *testing.T) {
+		resp, _ := do(http.MethodGet, "/healthz", "", nil)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		resp, _ = do(http.MethodGet, "/readyz", "", nil)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		pub.connected = false
+		resp, _ = do(http.MethodGet, "/readyz", "", nil)
+		require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+		pub.connected = true
+	})
+
+	t.Run("unauthorized", func(t *testing.T) {
+		resp, _ := do(http.MethodPost, "/v1/notifications", "", input)
+		require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+		resp, _ = do(http.MethodPost, "/v1/notifications", "wrong", input)
+		require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+		require.Empty(t, pub.published)
+	})
+
+	var published []byte
+	t.Run("publish input", func(t *testing.T) {
+		resp, result := do(http.MethodPost, "/v1/notifications", "secret", input)
+		require.Equal(t, http.StatusCreated, resp.StatusCode, result)
+		require.Equal(t, StatusPublished, result["status"])
+		require.Equal(t, "wis2/us-test/data/core/weather/granule.nc", result["data_id"])
+		require.Equal(t, float64(0), result["reason_code"])
+		published = pub.published[topic]
+		require.NoError(t, ValidateNotification(published))
+
+		resp, status := do(http.MethodGet, "/v1/notifications/"+result["id"].(string), "secret", nil)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, result, status)
+
+		resp, rec := do(http.MethodGet, "/v1/history?data_id=wis2/us-test/data/core/weather/granule.nc", "secret", nil)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, "sha512", rec["integrity"].(map[string]any)["method"])
+	})
+
+	t.Run("publish message", func(t *testing.T) {
+		// a different message for the same data_id is a conflict
+		msg, err := DecodeNotification(published)
+		require.NoError(t, err)
+		msg.ID = genMessageID()
+		msg.Properties.Integrity.Value = sha512b64([]byte("yyy"))
+		dat, err := Encode(msg)
+		require.NoError(t, err)
+
+		resp, result := do(http.MethodPost, "/v1/notifications", "secret", PublishRequest{Topic: topic, Message: dat})
+		require.Equal(t, http.StatusCreated, resp.StatusCode, result)
+		require.Len(t, result["warnings"], 1)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		resp, result := do(http.MethodPost, "/v1/notifications", "secret", PublishRequest{Topic: topic, Message: json.RawMessage(`{}`)})
+		require.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+		require.Contains(t, result["problems"], "/: missing properties: 'id', 'conformsTo', 'type', 'geometry', 'properties', 'links'")
+
+		resp, _ = do(http.MethodPost, "/v1/notifications", "secret", PublishRequest{Topic: "not/a/topic", Input: fpath})
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+		resp, _ = do(http.MethodPost, "/v1/notifications", "secret", PublishRequest{Topic: topic})
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+		resp, _ = do(http.MethodPost, "/v1/notifications", "secret", map[string]any{"topic": topic, "unknown": 1})
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+		outside := input
+		outside.Input = filepath.Join(dir, "..", "granule.nc")
+		resp, result = do(http.MethodPost, "/v1/notifications", "secret", outside)
+		require.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+		require.Contains(t, result["error"], "not in an allowed directory")
+
+		// symlinks are resolved
+		target := filepath.Join(t.TempDir(), "granule.nc")
+		require.NoError(t, os.WriteFile(target, []byte("xxx"), 0o644))
+		link := filepath.Join(dir, "link.nc")
+		require.NoError(t, os.Symlink(target, link))
+		outside.Input = link
+		resp, result = do(http.MethodPost, "/v1/notifications", "secret", outside)
+		require.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+		require.Contains(t, result["error"], "not in an allowed directory")
+
+		file := input
+		file.Geometry = json.RawMessage(`"/etc/passwd"`)
+		resp, _ = do(http.MethodPost, "/v1/notifications", "secret", file)
+		require.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		pub.reasonCode = 0x87
+		defer func() { pub.reasonCode = 0 }()
+		resp, result := do(http.MethodPost, "/v1/notifications", "secret", input)
+		require.Equal(t, http.StatusBadGateway, resp.StatusCode)
+		require.Equal(t, StatusFailed, result["status"])
+		require.Equal(t, "not authorized", result["reason"])
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		resp, _ := do(http.MethodGet, "/v1/notifications/xxx", "secret", nil)
+		require.Equal(t, http.StatusNotFound, resp.StatusCode)
+		resp, _ = do(http.MethodGet, "/v1/history?data_id=xxx", "secret", nil)
+		require.Equal(t, http.StatusNotFound, resp.StatusCode)
+		resp, _ = do(http.MethodDelete, "/v1/history", "secret", nil)
+		require.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+	})
+}
+
+func TestServerNoInputDirs(t *testing.T) {
+	fpath := filepath.Join(t.TempDir(), "granule.nc")
+	require.NoError(t, os.WriteFile(fpath, []byte("xxx"), 0o644))
+	s := NewServer(ServerConfig{Publisher: &fakePublisher{}, Token: "secret"})
+	_, err := s.newMessage(context.Background(), PublishRequest{
+		Topic:       "origin/a/wis2/us-test/data/core/weather",
+		Input:       fpath,
+		DownloadURL: "https://server/granule.nc",
+	})
+	require.ErrorContains(t, err, "local inputs are not allowed")
+}
@@ -0,0 +1,187 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"mime"
+	"strings"
+)
+
+const (
+	// MimeDetectAuto uses the file extension, and only reads the file content if the
+	// extension is unknown.
+	MimeDetectAuto = "auto"
+	// MimeDetectContent uses the file content, falling back to the extension if the
+	// content is not recognized. The extension is used if it is a more specific type
+	// consistent with the content, e.g., NetCDF4 rather than HDF5.
+	MimeDetectContent = "content"
+	// MimeDetectExtension only uses the file extension.
+	MimeDetectExtension = "extension"
+
+	octetStream = "application/octet-stream"
+	// number of leading bytes read to determine content type
+	sniffLen = 4096
+	// BUFR and GRIB messages may be preceded by a GTS abbreviated heading
+	maxMagicOffset = 256
+)
+
+var (
+	hdf5Magic = []byte("\x89HDF\r\n\x1a\n")
+	hdf4Magic = []byte("\x0e\x03\x13\x01")
+	capNS     = []byte("urn:oasis:names:tc:emergency:cap:")
+)
+
+// sniffCompatible are types that may be determined by extension which are consistent
+// with a type determined by content, i.e., the content type is more general.
+var sniffCompatible = map[string][]string{
+	"application/x-hdf5":              {"application/x-netcdf", "application/netcdf", "application/x-netcdf4"},
+	"application/x-netcdf":            {"application/netcdf"},
+	"application/xml":                 {"text/xml", "application/cap+xml"},
+	"image/tiff; application=geotiff": {"image/tiff"},
+	"image/tiff":                      {"image/tiff; application=geotiff"},
+	"application/gzip":                {"application/x-gzip"},
+	"application/x-bzip2":             {"application/x-bzip"},
+	"application/zip":                 {"application/x-zip-compressed"},
+	"application/cap+xml":             {"application/xml", "text/xml"},
+	"application/x-hdf":               {"application/x-hdf4"},
+	"application/grib":                {"application/x-grib", "application/grib2"},
+	"application/bufr":                {"application/x-bufr"},
+}
+
+// sniffMimeType returns the mime type of the content beginning with head, or an empty
+// string if not recognized.
+func sniffMimeType(head []byte) string {
+	prefix := head
+	if len(prefix) > maxMagicOffset {
+		prefix = prefix[:maxMagicOffset]
+	}
+	if idx := bytes.Index(prefix, []byte("BUFR")); idx >= 0 && len(head) > idx+7 {
+		if ed := head[idx+7]; ed == 3 || ed == 4 {
+			return "application/bufr"
+		}
+	}
+	if idx := bytes.Index(prefix, []byte("GRIB")); idx >= 0 && len(head) > idx+7 {
+		if ed := head[idx+7]; ed == 1 || ed == 2 {
+			return "application/grib"
+		}
+	}
+	switch {
+	case bytes.HasPrefix(head, []byte("CDF\x01")), bytes.HasPrefix(head, []byte("CDF\x02")),
+		bytes.HasPrefix(head, []byte("CDF\x05")):
+		return "application/x-netcdf"
+	case bytes.HasPrefix(head, hdf5Magic):
+		// NetCDF4 files are HDF5 files
+		return "application/x-hdf5"
+	case bytes.HasPrefix(head, hdf4Magic):
+		return "application/x-hdf"
+	case bytes.HasPrefix(head, []byte("II*\x00")), bytes.HasPrefix(head, []byte("MM\x00*")):
+		if isGeoTIFF(head) {
+			return "image/tiff; application=geotiff"
+		}
+		return "image/tiff"
+	case bytes.HasPrefix(head, []byte("\x1f\x8b")):
+		return "application/gzip"
+	case bytes.HasPrefix(head, []byte("BZh")):
+		return "application/x-bzip2"
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")):
+		return "application/zip"
+	}
+	trimmed := bytes.TrimLeft(head, "\xef\xbb\xbf \t\r\n")
+	if bytes.HasPrefix(trimmed, []byte("<?xml")) || bytes.HasPrefix(trimmed, []byte("<alert")) {
+		if bytes.Contains(head, capNS) {
+			return "application/cap+xml"
+		}
+		return "application/xml"
+	}
+	return ""
+}
+
+// isGeoTIFF reports whether the first IFD of a TIFF contains the GeoKeyDirectory tag.
+// If the IFD is not within head it is assumed not to be a GeoTIFF.
+func isGeoTIFF(head []byte) bool {
+	if len(head) < 8 {
+		return false
+	}
+	var order binary.ByteOrder = binary.LittleEndian
+	if head[0] == 'M' {
+		order = binary.BigEndian
+	}
+	off := int(order.Uint32(head[4:8]))
+	if off+2 > len(head) {
+		return false
+	}
+	count := int(order.Uint16(head[off:]))
+	for i := 0; i < count; i++ {
+		entry := off + 2 + i*12
+		if entry+2 > len(head) {
+			return false
+		}
+		if order.Uint16(head[entry:]) == 34735 {
+			return true
+		}
+	}
+	return false
+}
+
+func baseMimeType(typ string) string {
+	// keep the geotiff profile parameter
+	if strings.HasPrefix(typ, "image/tiff; application=") {
+		return typ
+	}
+	if t, _, err := mime.ParseMediaType(typ); err == nil {
+		return t
+	}
+	return typ
+}
+
+func mimeTypesCompatible(sniffed, byExt string) bool {
+	sniffed, byExt = baseMimeType(sniffed), baseMimeType(byExt)
+	if sniffed == byExt {
+		return true
+	}
+	for _, typ := range sniffCompatible[sniffed] {
+		if typ == byExt {
+			return true
+		}
+	}
+	return false
+}
+
+// DetectMimeType determines the mime type of input by its file extension and/or its
+// content according to mode, one of MimeDetectAuto, MimeDetectContent or
+// MimeDetectExtension.
+func DetectMimeType(ctx context.Context, input Input, mode string) (string, error) {
+	byExt := mimeTypeByExtension(input.Name())
+	switch mode {
+	case MimeDetectExtension:
+		return byExt, nil
+	case MimeDetectAuto:
+		// reading the content can mean downloading remote inputs, so only do it if needed
+		if byExt != octetStream {
+			return byExt, nil
+		}
+	case MimeDetectContent:
+	default:
+		return "", fmt.Errorf("invalid mime type detection mode: %s", mode)
+	}
+
+	r, err := input.Open(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", fmt.Errorf("reading input: %w", err)
+	}
+
+	sniffed := sniffMimeType(head[:n])
+	if sniffed == "" || mimeTypesCompatible(sniffed, byExt) {
+		return byExt, nil
+	}
+	return sniffed, nil
+}
@@ -0,0 +1,104 @@
+package internal
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSniffMimeType(t *testing.T) {
+	// little endian tiff with a single IFD entry for the GeoKeyDirectoryTag (34735)
+	geotiff := []byte("II*\x00\x08\x00\x00\x00\x01\x00\xaf\x87\x03\x00\x04\x00\x00\x00\x00\x00\x00\x00")
+	cases := []struct {
+		name     string
+		head     []byte
+		expected string
+	}{
+		{"bufr3", []byte("BUFR\x00\x00\x40\x03"), "application/bufr"},
+		{"bufr4", []byte("BUFR\x00\x00\x40\x04"), "application/bufr"},
+		{"bufr with gts header", []byte("ISMD01 KWBC 010000\r\r\nBUFR\x00\x00\x40\x04"), "application/bufr"},
+		{"bufr bad edition", []byte("BUFR\x00\x00\x40\x09"), ""},
+		{"grib1", []byte("GRIB\x00\x00\x40\x01"), "application/grib"},
+		{"grib2", []byte("GRIB\x00\x00\x00\x02"), "application/grib"},
+		{"netcdf classic", []byte("CDF\x01\x00\x00"), "application/x-netcdf"},
+		{"netcdf 64bit", []byte("CDF\x02\x00\x00"), "application/x-netcdf"},
+		{"netcdf4/hdf5", []byte("\x89HDF\r\n\x1a\n\x00"), "application/x-hdf5"},
+		{"hdf4", []byte("\x0e\x03\x13\x01\x00"), "application/x-hdf"},
+		{"tiff", []byte("MM\x00*\x00\x00\x00\x08\x00\x00"), "image/tiff"},
+		{"geotiff", geotiff, "image/tiff; application=geotiff"},
+		{"gzip", []byte("\x1f\x8b\x08\x00"), "application/gzip"},
+		{"bzip2", []byte("BZh91AY"), "application/x-bzip2"},
+		{"zip", []byte("PK\x03\x04\x14\x00"), "application/zip"},
+		{"xml", []byte("<?xml version=\"1.0\"?><foo/>"), "application/xml"},
+		{"cap", []byte("<?xml version=\"1.0\"?>\n<alert xmlns=\"urn:oasis:names:tc:emergency:cap:1.2\">"), "application/cap+xml"},
+		{"unknown", []byte("hello world"), ""},
+		{"empty", []byte{}, ""},
+	}
+	for _, test := range cases {
+		require.Equal(t, test.expected, sniffMimeType(test.head), test.name)
+	}
+}
+
+func TestDetectMimeType(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, dat []byte) Input {
+		fpath := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(fpath, dat, 0o644))
+		in, err := NewInput(fpath, InputConfig{})
+		require.NoError(t, err)
+		return in
+	}
+	bufr := []byte("BUFR\x00\x00\x40\x04")
+
+	cases := []struct {
+		name     string
+		input    Input
+		mode     string
+		expected string
+	}{
+		{"no extension", write("foo", bufr), MimeDetectAuto, "application/bufr"},
+		{"no extension by extension", write("foo1", bufr), MimeDetectExtension, "application/octet-stream"},
+		{"conflicting", write("foo.grib", bufr), MimeDetectContent, "application/bufr"},
+		{"conflicting auto", write("foo3.grib", bufr), MimeDetectAuto, "application/grib"},
+		{"conflicting by extension", write("foo2.grib", bufr), MimeDetectExtension, "application/grib"},
+		{"unrecognized content", write("foo.bufr", []byte("xxx")), MimeDetectAuto, "application/bufr"},
+		{"compatible", write("foo.bufr.bin", bufr), MimeDetectContent, "application/bufr"},
+	}
+	for _, test := range cases {
+		typ, err := DetectMimeType(context.Background(), test.input, test.mode)
+		require.NoError(t, err, test.name)
+		require.Equal(t, test.expected, typ, test.name)
+	}
+
+	// netcdf4 is more specific than hdf5 when the extension is known
+	require.True(t, mimeTypesCompatible("application/x-hdf5", "application/x-netcdf"))
+	require.False(t, mimeTypesCompatible("application/bufr", "application/grib"))
+
+	_, err := DetectMimeType(context.Background(), write("foo.x", bufr), "bogus")
+	require.Error(t, err)
+
+	// remote inputs with a known extension are not downloaded
+	gets := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gets++
+		w.Write(bufr)
+	}))
+	defer srv.Close()
+	in, err := NewInput(srv.URL+"/foo.bufr", InputConfig{})
+	require.NoError(t, err)
+	typ, err := DetectMimeType(context.Background(), in, MimeDetectAuto)
+	require.NoError(t, err)
+	require.Equal(t, "application/bufr", typ)
+	require.Zero(t, gets)
+	in, err = NewInput(srv.URL+"/foo", InputConfig{})
+	require.NoError(t, err)
+	typ, err = DetectMimeType(context.Background(), in, MimeDetectAuto)
+	require.NoError(t, err)
+	require.Equal(t, "application/bufr", typ)
+	require.Equal(t, 1, gets)
+}
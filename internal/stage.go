@@ -0,0 +1,418 @@
+package internal
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// Stager copies product files to a destination where they can be downloaded from.
+type Stager interface {
+	// Stage writes size bytes from r to relpath, relative to the destination root, and
+	// returns the size of the file as reported by the destination after writing.
+	Stage(ctx context.Context, r io.Reader, size int64, relpath string) (int64, error)
+	Close() error
+}
+
+// StageConfig configures access to staging destinations.
+type StageConfig struct {
+	// Client is used for WebDAV and S3 destinations. http.DefaultClient is used if nil.
+	Client *http.Client
+	S3     S3Config
+	// User and Password are used for WebDAV and SFTP destinations. If User is not set
+	// the user from the destination URL is used.
+	User     string
+	Password string
+	// SSHKey is the path to a private key file used for SFTP destinations. The SSH agent
+	// is also used if SSH_AUTH_SOCK is set.
+	SSHKey string
+	// KnownHosts is the known hosts file used to verify SFTP servers. Defaults to
+	// ~/.ssh/known_hosts.
+	KnownHosts string
+}
+
+func (c StageConfig) client() *http.Client {
+	if c.Client == nil {
+		return http.DefaultClient
+	}
+	return c.Client
+}
+
+// NewStager returns a Stager for a destination, which can be a local directory path or
+// a file://, sftp://, webdav:// (http), webdavs:// (https), or s3://<bucket>/<prefix>
+// URL.
+func NewStager(dest string, cfg StageConfig) (Stager, error) {
+	u, err := url.Parse(dest)
+	if err != nil || u.Scheme == "" || len(u.Scheme) == 1 {
+		return &dirStager{root: dest}, nil
+	}
+	switch u.Scheme {
+	case "file":
+		return &dirStager{root: u.Path}, nil
+	case "webdav", "webdavs", "dav", "davs":
+		if strings.HasSuffix(u.Scheme, "s") {
+			u.Scheme = "https"
+		} else {
+			u.Scheme = "http"
+		}
+		if cfg.User == "" && u.User != nil {
+			cfg.User = u.User.Username()
+		}
+		u.User = nil
+		return &webdavStager{root: u, cfg: cfg}, nil
+	case "s3":
+		if u.Host == "" {
+			return nil, fmt.Errorf("s3 destination must be of the form s3://<bucket>[/<prefix>]")
+		}
+		return &s3Stager{bucket: u.Host, prefix: strings.Trim(u.Path, "/"), cfg: cfg}, nil
+	case "sftp":
+		return newSFTPStager(u, cfg)
+	}
+	return nil, fmt.Errorf("unsupported staging destination scheme: %s", u.Scheme)
+}
+
+// StageInput copies input to relpath using stager, checking the input content read
+// while staging matches the length and checksum in info, and the stager reports writing
+// all of it. The staged content is not read back from the destination.
+func StageInput(ctx context.Context, stager Stager, input Input, info *InputInfo, relpath string) error {
+	r, err := input.Open(ctx)
+	if err != nil {
+		return fmt.Errorf("opening input: %w", err)
+	}
+	defer r.Close()
+
+	h, err := newHash(info.Integrity.Method)
+	if err != nil {
+		return err
+	}
+	size, err := stager.Stage(ctx, io.TeeReader(r, h), info.Size, relpath)
+	if err != nil {
+		return fmt.Errorf("staging %s: %w", relpath, err)
+	}
+	if size != info.Size {
+		return fmt.Errorf("staged size %d does not match input size %d", size, info.Size)
+	}
+	if base64.StdEncoding.EncodeToString(h.Sum(nil)) != info.Integrity.Value {
+		return fmt.Errorf("staged content checksum does not match input")
+	}
+	return nil
+}
+
+// StagedURL returns the download URL for a file staged to relpath given the base URL of
+// the staging destination. relpath should be cleaned with CleanStagePath.
+func StagedURL(base *url.URL, relpath string) *url.URL {
+	u := *base
+	escaped := []string{}
+	for _, p := range strings.Split(relpath, "/") {
+		escaped = append(escaped, url.PathEscape(p))
+	}
+	u.Path = strings.TrimSuffix(base.Path, "/") + "/" + strings.TrimPrefix(relpath, "/")
+	u.RawPath = strings.TrimSuffix(base.EscapedPath(), "/") + "/" + strings.TrimPrefix(strings.Join(escaped, "/"), "/")
+	return &u
+}
+
+// CleanStagePath returns relpath cleaned so it cannot escape the staging destination
+// root, which is the path stagers write to.
+func CleanStagePath(relpath string) (string, error) {
+	p := path.Clean("/" + relpath)
+	if p == "/" {
+		return "", fmt.Errorf("invalid staging path: %q", relpath)
+	}
+	return p[1:], nil
+}
+
+// dirStager writes files to a local directory, e.g., a web server root.
+type dirStager struct {
+	root string
+}
+
+func (s *dirStager) Stage(_ context.Context, r io.Reader, _ int64, relpath string) (int64, error) {
+	relpath, err := CleanStagePath(relpath)
+	if err != nil {
+		return 0, err
+	}
+	dest := filepath.Join(s.root, filepath.FromSlash(relpath))
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return 0, err
+	}
+	// write to a temporary file so the file is never served partially written
+	f, err := os.CreateTemp(filepath.Dir(dest), "."+filepath.Base(dest)+".*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(f.Name())
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return 0, err
+	}
+	if err := f.Chmod(0o644); err != nil {
+		f.Close()
+		return 0, err
+	}
+	if err := f.Close(); err != nil {
+		return 0, err
+	}
+	if err := os.Rename(f.Name(), dest); err != nil {
+		return 0, err
+	}
+	fi, err := os.Stat(dest)
+	if err != nil {
+		return 0, err
+	}
+	return fi.Size(), nil
+}
+
+func (s *dirStager) Close() error { return nil }
+
+type webdavStager struct {
+	root *url.URL
+	cfg  StageConfig
+}
+
+func (s *webdavStager) do(ctx context.Context, method string, u *url.URL, body io.Reader, size int64) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.ContentLength = size
+	}
+	if s.cfg.User != "" {
+		req.SetBasicAuth(s.cfg.User, s.cfg.Password)
+	}
+	resp, err := s.cfg.client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	return resp, nil
+}
+
+func (s *webdavStager) Stage(ctx context.Context, r io.Reader, size int64, relpath string) (int64, error) {
+	relpath, err := CleanStagePath(relpath)
+	if err != nil {
+		return 0, err
+	}
+	// create parent collections, which is not an error if they already exist
+	parts := strings.Split(relpath, "/")
+	for i := 1; i < len(parts); i++ {
+		u := StagedURL(s.root, strings.Join(parts[:i], "/")+"/")
+		resp, err := s.do(ctx, "MKCOL", u, nil, 0)
+		if err != nil {
+			return 0, err
+		}
+		if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusMethodNotAllowed {
+			return 0, fmt.Errorf("MKCOL %s: %s", u.Redacted(), resp.Status)
+		}
+	}
+
+	u := StagedURL(s.root, relpath)
+	resp, err := s.do(ctx, http.MethodPut, u, r, size)
+	if err != nil {
+		return 0, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return 0, fmt.Errorf("PUT %s: %s", u.Redacted(), resp.Status)
+	}
+
+	resp, err = s.do(ctx, http.MethodHead, u, nil, 0)
+	if err != nil {
+		return 0, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("HEAD %s: %s", u.Redacted(), resp.Status)
+	}
+	return resp.ContentLength, nil
+}
+
+func (s *webdavStager) Close() error { return nil }
+
+type s3Stager struct {
+	bucket string
+	prefix string
+	cfg    StageConfig
+}
+
+func (s *s3Stager) do(ctx context.Context, method string, u *url.URL, body io.Reader, size int64) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.ContentLength = size
+	}
+	s.cfg.S3.sign(req, "", time.Now())
+	resp, err := s.cfg.client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("%s %s: %s", method, u.Redacted(), resp.Status)
+	}
+	return resp, nil
+}
+
+func (s *s3Stager) Stage(ctx context.Context, r io.Reader, size int64, relpath string) (int64, error) {
+	relpath, err := CleanStagePath(relpath)
+	if err != nil {
+		return 0, err
+	}
+	u, err := s.cfg.S3.ObjectURL(s.bucket, path.Join(s.prefix, relpath))
+	if err != nil {
+		return 0, err
+	}
+	if _, err := s.do(ctx, http.MethodPut, u, r, size); err != nil {
+		return 0, err
+	}
+	resp, err := s.do(ctx, http.MethodHead, u, nil, 0)
+	if err != nil {
+		return 0, err
+	}
+	return resp.ContentLength, nil
+}
+
+func (s *s3Stager) Close() error { return nil }
+
+type sftpStager struct {
+	root   string
+	conn   *ssh.Client
+	client *sftp.Client
+	// agent is the SSH agent connection, if any
+	agent net.Conn
+}
+
+func newSFTPStager(u *url.URL, cfg StageConfig) (*sftpStager, error) {
+	user := cfg.User
+	if user == "" && u.User != nil {
+		user = u.User.Username()
+	}
+	if user == "" {
+		return nil, fmt.Errorf("sftp destination requires a user")
+	}
+
+	auth := []ssh.AuthMethod{}
+	var agentConn net.Conn
+	closeAgent := func() {
+		if agentConn != nil {
+			agentConn.Close()
+		}
+	}
+	if cfg.SSHKey != "" {
+		dat, err := os.ReadFile(cfg.SSHKey)
+		if err != nil {
+			return nil, fmt.Errorf("reading ssh key: %w", err)
+		}
+		signer, err := ssh.ParsePrivateKey(dat)
+		if err != nil {
+			return nil, fmt.Errorf("parsing ssh key: %w", err)
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		if conn, err := net.Dial("unix", sock); err == nil {
+			agentConn = conn
+			auth = append(auth, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+		}
+	}
+	if cfg.Password != "" {
+		auth = append(auth, ssh.Password(cfg.Password))
+	}
+
+	knownHostsPath := cfg.KnownHosts
+	if knownHostsPath == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			closeAgent()
+			return nil, err
+		}
+		knownHostsPath = filepath.Join(home, ".ssh", "known_hosts")
+	}
+	hostKeyCallback, err := knownhosts.New(knownHostsPath)
+	if err != nil {
+		closeAgent()
+		return nil, fmt.Errorf("loading known hosts: %w", err)
+	}
+
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "22")
+	}
+	conn, err := ssh.Dial("tcp", host, &ssh.ClientConfig{
+		User:            user,
+		Auth:            auth,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         30 * time.Second,
+	})
+	if err != nil {
+		closeAgent()
+		return nil, fmt.Errorf("connecting to %s: %w", host, err)
+	}
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		conn.Close()
+		closeAgent()
+		return nil, fmt.Errorf("starting sftp session: %w", err)
+	}
+	return &sftpStager{root: u.Path, conn: conn, client: client, agent: agentConn}, nil
+}
+
+func (s *sftpStager) Stage(_ context.Context, r io.Reader, _ int64, relpath string) (int64, error) {
+	relpath, err := CleanStagePath(relpath)
+	if err != nil {
+		return 0, err
+	}
+	dest := path.Join(s.root, relpath)
+	if err := s.client.MkdirAll(path.Dir(dest)); err != nil {
+		return 0, err
+	}
+	// write to a uniquely named temporary file so concurrent uploads of the same path do
+	// not overwrite each other before the rename
+	tmp := path.Join(path.Dir(dest), "."+path.Base(dest)+"."+uuid.New().String()[:8])
+	f, err := s.client.Create(tmp)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := f.ReadFrom(r); err != nil {
+		f.Close()
+		s.client.Remove(tmp)
+		return 0, err
+	}
+	if err := f.Close(); err != nil {
+		s.client.Remove(tmp)
+		return 0, err
+	}
+	if err := s.client.PosixRename(tmp, dest); err != nil {
+		s.client.Remove(tmp)
+		return 0, err
+	}
+	fi, err := s.client.Stat(dest)
+	if err != nil {
+		return 0, err
+	}
+	return fi.Size(), nil
+}
+
+func (s *sftpStager) Close() error {
+	s.client.Close()
+	err := s.conn.Close()
+	if s.agent != nil {
+		s.agent.Close()
+	}
+	return err
+}
@@ -0,0 +1,152 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStagedURL(t *testing.T) {
+	base, err := url.Parse("https://server/pub/")
+	require.NoError(t, err)
+	require.Equal(t, "https://server/pub/2025/034/foo%20bar.bufr", StagedURL(base, "2025/034/foo bar.bufr").String())
+
+	base, err = url.Parse("https://server")
+	require.NoError(t, err)
+	require.Equal(t, "https://server/foo.bufr", StagedURL(base, "/foo.bufr").String())
+
+	relpath, err := CleanStagePath("2025/./034/../../../foo.bufr")
+	require.NoError(t, err)
+	require.Equal(t, "foo.bufr", relpath)
+	require.Equal(t, "https://server/foo.bufr", StagedURL(base, relpath).String())
+	_, err = CleanStagePath("../")
+	require.Error(t, err)
+}
+
+func newStagedInput(t *testing.T, content []byte) (Input, *InputInfo) {
+	fpath := filepath.Join(t.TempDir(), "foo.bufr")
+	require.NoError(t, os.WriteFile(fpath, content, 0o644))
+	in, err := NewInput(fpath, InputConfig{})
+	require.NoError(t, err)
+	info, err := in.Info(context.Background())
+	require.NoError(t, err)
+	return in, info
+}
+
+func TestDirStager(t *testing.T) {
+	content := []byte("some bufr content")
+	in, info := newStagedInput(t, content)
+
+	root := t.TempDir()
+	stager, err := NewStager(root, StageConfig{})
+	require.NoError(t, err)
+
+	require.NoError(t, StageInput(context.Background(), stager, in, info, "2025/034/foo.bufr"))
+	dat, err := os.ReadFile(filepath.Join(root, "2025", "034", "foo.bufr"))
+	require.NoError(t, err)
+	require.Equal(t, content, dat)
+
+	// cannot escape the root
+	require.NoError(t, StageInput(context.Background(), stager, in, info, "../../foo.bufr"))
+	_, err = os.Stat(filepath.Join(root, "foo.bufr"))
+	require.NoError(t, err)
+
+	// content does not match what is expected
+	bad := *info
+	bad.Integrity.Value = "xxx"
+	require.Error(t, StageInput(context.Background(), stager, in, &bad, "foo.bufr"))
+}
+
+// memServer is a minimal in-memory stand-in for a WebDAV or S3 server
+type memServer struct {
+	mu    sync.Mutex
+	files map[string][]byte
+	cols  map[string]bool
+	check func(r *http.Request) bool
+}
+
+func (s *memServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.check != nil && !s.check(r) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	switch r.Method {
+	case "MKCOL":
+		if s.cols[r.URL.Path] {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		s.cols[r.URL.Path] = true
+		w.WriteHeader(http.StatusCreated)
+	case http.MethodPut:
+		dat, _ := io.ReadAll(r.Body)
+		s.files[r.URL.Path] = dat
+		w.WriteHeader(http.StatusCreated)
+	case http.MethodHead, http.MethodGet:
+		dat, ok := s.files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(dat))
+	}
+}
+
+func TestWebDAVStager(t *testing.T) {
+	content := []byte("some bufr content")
+	in, info := newStagedInput(t, content)
+
+	mem := &memServer{files: map[string][]byte{}, cols: map[string]bool{}, check: func(r *http.Request) bool {
+		user, passwd, ok := r.BasicAuth()
+		return ok && user == "user" && passwd == "passwd"
+	}}
+	srv := httptest.NewServer(mem)
+	defer srv.Close()
+
+	dest := strings.Replace(srv.URL, "http://", "webdav://user@", 1) + "/dav"
+	stager, err := NewStager(dest, StageConfig{Password: "passwd"})
+	require.NoError(t, err)
+
+	require.NoError(t, StageInput(context.Background(), stager, in, info, "2025/034/foo.bufr"))
+	require.Equal(t, content, mem.files["/dav/2025/034/foo.bufr"])
+	require.True(t, mem.cols["/dav/2025/"])
+	require.True(t, mem.cols["/dav/2025/034/"])
+
+	// collections already exist
+	require.NoError(t, StageInput(context.Background(), stager, in, info, "2025/034/foo.bufr"))
+}
+
+func TestS3Stager(t *testing.T) {
+	content := []byte("some bufr content")
+	in, info := newStagedInput(t, content)
+
+	mem := &memServer{files: map[string][]byte{}, check: func(r *http.Request) bool {
+		return strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=KEY/")
+	}}
+	srv := httptest.NewServer(mem)
+	defer srv.Close()
+
+	stager, err := NewStager("s3://bucket/prefix", StageConfig{
+		S3: S3Config{Endpoint: srv.URL, AccessKey: "KEY", SecretKey: "SECRET"},
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, StageInput(context.Background(), stager, in, info, "2025/foo.bufr"))
+	require.Equal(t, content, mem.files["/bucket/prefix/2025/foo.bufr"])
+
+	_, err = NewStager("s3:///prefix", StageConfig{})
+	require.Error(t, err)
+}
@@ -0,0 +1,250 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+var wigosIDRegexp = regexp.MustCompile(`^(\d{1,2})-(\d{1,5})-(\d{1,5})-([0-9A-Za-z]{1,16})$`)
+
+// ValidateWigosID checks the syntax of a WIGOS station identifier, i.e.,
+// <series>-<issuer>-<issue number>-<local identifier>, e.g., 0-20000-0-12345. Only
+// identifier series 0 is defined.
+func ValidateWigosID(id string) error {
+	m := wigosIDRegexp.FindStringSubmatch(id)
+	if m == nil {
+		return fmt.Errorf("invalid wigos station identifier %q, expected <series>-<issuer>-<issue number>-<local id>", id)
+	}
+	if m[1] != "0" {
+		return fmt.Errorf("invalid wigos station identifier %q, unsupported series %s", id, m[1])
+	}
+	for _, v := range m[2:4] {
+		if n, _ := strconv.Atoi(v); n > 65534 {
+			return fmt.Errorf("invalid wigos station identifier %q, %s is out of range", id, v)
+		}
+	}
+	return nil
+}
+
+// Station is an observing station from a station registry
+type Station struct {
+	WigosID string
+	Name    string
+	Lon     float64
+	Lat     float64
+}
+
+// StationRegistry are stations by WIGOS station identifier
+type StationRegistry struct {
+	stations map[string]Station
+}
+
+// Lookup returns the station with the WIGOS station identifier id
+func (r *StationRegistry) Lookup(id string) (Station, bool) {
+	if r == nil {
+		return Station{}, false
+	}
+	s, ok := r.stations[id]
+	return s, ok
+}
+
+// Len is the number of identifiers in the registry
+func (r *StationRegistry) Len() int { return len(r.stations) }
+
+// stationColumns maps normalized CSV column and JSON property names to station fields
+var stationColumns = map[string]string{
+	"wigosid":                 "id",
+	"wigosstationidentifier":  "id",
+	"wigosstationidentifiers": "id",
+	"wsi":                     "id",
+	"name":                    "name",
+	"station":                 "name",
+	"stationname":             "name",
+	"latitude":                "lat",
+	"lat":                     "lat",
+	"longitude":               "lon",
+	"lon":                     "lon",
+}
+
+// normalizeColumn lower cases name and removes non-alphanumeric characters so, e.g.,
+// "WIGOS Station Identifier(s)" and "wigosStationIdentifiers" are the same.
+func normalizeColumn(name string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, name)
+}
+
+// LoadStationRegistry loads a station registry from a CSV or JSON file, such as an
+// OSCAR/Surface station export. Files with a .json extension, or with content starting
+// with [ or {, are JSON, otherwise CSV.
+//
+// CSV files must have a header with columns for the WIGOS identifier(s), latitude and
+// longitude, e.g., "WIGOS Station Identifier(s)", "Latitude" and "Longitude". JSON files
+// are either an array of station objects, or an object with the array in its
+// stationSearchResults property as returned by the OSCAR/Surface API. Stations with
+// multiple identifiers, separated by commas or semicolons, are registered under each.
+func LoadStationRegistry(fpath string) (*StationRegistry, error) {
+	dat, err := os.ReadFile(fpath)
+	if err != nil {
+		return nil, err
+	}
+	var rows []map[string]any
+	trimmed := bytes.TrimSpace(bytes.TrimPrefix(dat, []byte("\ufeff")))
+	if strings.EqualFold(filepath.Ext(fpath), ".json") || bytes.HasPrefix(trimmed, []byte("[")) || bytes.HasPrefix(trimmed, []byte("{")) {
+		rows, err = stationJSONRows(trimmed)
+	} else {
+		rows, err = stationCSVRows(bytes.NewReader(trimmed))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading station registry %s: %w", fpath, err)
+	}
+
+	reg := &StationRegistry{stations: map[string]Station{}}
+	for i, row := range rows {
+		station, ids, err := stationFromRow(row)
+		if err != nil {
+			return nil, fmt.Errorf("reading station registry %s: station %d: %w", fpath, i+1, err)
+		}
+		for _, id := range ids {
+			station.WigosID = id
+			reg.stations[id] = station
+		}
+	}
+	return reg, nil
+}
+
+func stationCSVRows(r io.Reader) ([]map[string]any, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.LazyQuotes = true
+	header, err := cr.Read()
+	if err != nil {
+		return nil, err
+	}
+	rows := []map[string]any{}
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		row := map[string]any{}
+		for i, name := range header {
+			if i < len(rec) {
+				row[name] = rec[i]
+			}
+		}
+		rows = append(rows, row)
+	}
+}
+
+func stationJSONRows(dat []byte) ([]map[string]any, error) {
+	rows := []map[string]any{}
+	if bytes.HasPrefix(dat, []byte("[")) {
+		return rows, json.Unmarshal(dat, &rows)
+	}
+	var results struct {
+		StationSearchResults []map[string]any `json:"stationSearchResults"`
+	}
+	if err := json.Unmarshal(dat, &results); err != nil {
+		return nil, err
+	}
+	if results.StationSearchResults == nil {
+		return nil, fmt.Errorf("expected an array of stations or stationSearchResults")
+	}
+	return results.StationSearchResults, nil
+}
+
+// stationFromRow returns the station and its WIGOS identifiers from a CSV row or JSON
+// object. Rows without an identifier or location are ignored.
+func stationFromRow(row map[string]any) (Station, []string, error) {
+	station := Station{}
+	var ids []string
+	var lat, lon *float64
+	for name, val := range row {
+		switch stationColumns[normalizeColumn(name)] {
+		case "id":
+			ids = append(ids, stationIDs(val)...)
+		case "name":
+			station.Name, _ = val.(string)
+		case "lat", "lon":
+			v, ok, err := stationCoord(val)
+			if err != nil {
+				return station, nil, fmt.Errorf("%s: %w", name, err)
+			}
+			if !ok {
+				continue
+			}
+			if stationColumns[normalizeColumn(name)] == "lat" {
+				lat = &v
+			} else {
+				lon = &v
+			}
+		}
+	}
+	if len(ids) == 0 || lat == nil || lon == nil {
+		return station, nil, nil
+	}
+	station.Lat, station.Lon = *lat, *lon
+	if err := NewPoint(station.Lon, station.Lat).Validate(); err != nil {
+		return station, nil, err
+	}
+	valid := []string{}
+	for _, id := range ids {
+		if ValidateWigosID(id) == nil {
+			valid = append(valid, id)
+		}
+	}
+	return station, valid, nil
+}
+
+// stationIDs returns the identifiers in a string, array of strings, or array of
+// objects with a wigosStationIdentifier property.
+func stationIDs(val any) []string {
+	ids := []string{}
+	switch v := val.(type) {
+	case string:
+		ids = append(ids, strings.FieldsFunc(v, func(r rune) bool { return r == ',' || r == ';' || unicode.IsSpace(r) })...)
+	case []any:
+		for _, item := range v {
+			if obj, ok := item.(map[string]any); ok {
+				item = obj["wigosStationIdentifier"]
+			}
+			ids = append(ids, stationIDs(item)...)
+		}
+	}
+	return ids
+}
+
+func stationCoord(val any) (float64, bool, error) {
+	switch v := val.(type) {
+	case float64:
+		return v, true, nil
+	case string:
+		if strings.TrimSpace(v) == "" {
+			return 0, false, nil
+		}
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			return 0, false, fmt.Errorf("not a number: %q", v)
+		}
+		return f, true, nil
+	case nil:
+		return 0, false, nil
+	}
+	return 0, false, fmt.Errorf("not a number: %v", val)
+}
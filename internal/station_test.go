@@ -0,0 +1,112 @@
+package internal
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateWigosID(t *testing.T) {
+	for _, id := range []string{"0-20000-0-12345", "0-840-0-KMSN", "0-20008-0-A1B2C3D4E5F6G7H8"} {
+		require.NoError(t, ValidateWigosID(id), id)
+	}
+	for _, id := range []string{"", "12345", "0-20000-12345", "1-20000-0-12345", "0-70000-0-12345", "0-20000-0-12_45", "0-20000-0-"} {
+		require.Error(t, ValidateWigosID(id), id)
+	}
+}
+
+func TestLoadStationRegistry(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		fpath := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(fpath, []byte(content), 0o644))
+		return fpath
+	}
+
+	t.Run("csv", func(t *testing.T) {
+		reg, err := LoadStationRegistry(write("stations.csv", "\ufeff"+
+			"Station,WIGOS Station Identifier(s),Station type,Latitude,Longitude,Elevation\n"+
+			"MADISON,\"0-20000-0-72641,0-840-0-KMSN\",Land (fixed),43.14,-89.35,264\n"+
+			"NO LOCATION,0-20000-0-99999,Land (fixed),,,\n"+
+			"BAD ID,12345,Land (fixed),10,10,0\n"))
+		require.NoError(t, err)
+		require.Equal(t, 2, reg.Len())
+		station, ok := reg.Lookup("0-840-0-KMSN")
+		require.True(t, ok)
+		require.Equal(t, Station{WigosID: "0-840-0-KMSN", Name: "MADISON", Lon: -89.35, Lat: 43.14}, station)
+		_, ok = reg.Lookup("0-20000-0-99999")
+		require.False(t, ok)
+	})
+
+	t.Run("oscar json", func(t *testing.T) {
+		reg, err := LoadStationRegistry(write("oscar.json", `{"stationSearchResults": [
+			{"name": "MADISON", "wigosStationIdentifiers": [{"wigosStationIdentifier": "0-20000-0-72641", "primary": true}],
+			 "latitude": 43.14, "longitude": -89.35}
+		]}`))
+		require.NoError(t, err)
+		station, ok := reg.Lookup("0-20000-0-72641")
+		require.True(t, ok)
+		require.Equal(t, -89.35, station.Lon)
+	})
+
+	t.Run("json array", func(t *testing.T) {
+		reg, err := LoadStationRegistry(write("stations.txt", `[{"wigosId": "0-20000-0-72641", "lat": "43.14", "lon": "-89.35"}]`))
+		require.NoError(t, err)
+		_, ok := reg.Lookup("0-20000-0-72641")
+		require.True(t, ok)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := LoadStationRegistry(write("range.csv", "wigosId,latitude,longitude\n0-20000-0-72641,100,0\n"))
+		require.Error(t, err)
+		_, err = LoadStationRegistry(write("number.csv", "wigosId,latitude,longitude\n0-20000-0-72641,north,0\n"))
+		require.Error(t, err)
+		_, err = LoadStationRegistry(write("object.json", `{"stations": []}`))
+		require.Error(t, err)
+		_, err = LoadStationRegistry(filepath.Join(dir, "missing.csv"))
+		require.Error(t, err)
+	})
+}
+
+func TestNewNotificationMessageStation(t *testing.T) {
+	fpath := filepath.Join(t.TempDir(), "obs.bufr")
+	require.NoError(t, os.WriteFile(fpath, []byte("xxx"), 0o644))
+	in, err := NewInput(fpath, InputConfig{})
+	require.NoError(t, err)
+	reg := &StationRegistry{stations: map[string]Station{
+		"0-20000-0-72641": {WigosID: "0-20000-0-72641", Lon: -89.35, Lat: 43.14},
+	}}
+
+	downloadURL, _ := url.Parse("https://server/obs.bufr")
+	opts := NotificationOptions{
+		Topic:       "origin/a/wis2/centre/data/core/weather",
+		DownloadURL: downloadURL,
+		WigosID:     "0-20000-0-72641",
+		Stations:    reg,
+	}
+	msg, err := NewNotificationMessage(context.Background(), in, opts)
+	require.NoError(t, err)
+	require.Equal(t, "0-20000-0-72641", msg.Properties.WigosID)
+	require.Equal(t, NewPoint(-89.35, 43.14), msg.Geometry)
+
+	// provided geometry takes precedence
+	opts.Geometry = NewPoint(1, 2)
+	msg, err = NewNotificationMessage(context.Background(), in, opts)
+	require.NoError(t, err)
+	require.Equal(t, NewPoint(1, 2), msg.Geometry)
+
+	// not in the registry
+	opts.Geometry = nil
+	opts.WigosID = "0-20000-0-72642"
+	msg, err = NewNotificationMessage(context.Background(), in, opts)
+	require.NoError(t, err)
+	require.Nil(t, msg.Geometry)
+
+	opts.WigosID = "72641"
+	_, err = NewNotificationMessage(context.Background(), in, opts)
+	require.Error(t, err)
+}
@@ -0,0 +1,231 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// WNMConformance is the WIS2 Notification Message core conformance class
+const WNMConformance = "http://wis.wmo.int/spec/wnm/1/conf/core"
+
+//go:embed schema/wis2-notification-message-bundled.json
+var wnmSchema []byte
+
+const wnmSchemaURL = "https://schemas.wmo.int/wnm/1.0.0/schemas/wis2-notification-message-bundled.json"
+
+var (
+	wnmOnce     sync.Once
+	wnmCompiled *jsonschema.Schema
+	wnmErr      error
+)
+
+func compiledWNMSchema() (*jsonschema.Schema, error) {
+	wnmOnce.Do(func() {
+		c := jsonschema.NewCompiler()
+		c.Draft = jsonschema.Draft2020
+		// the id, datetimes and hrefs are only checked if formats are asserted
+		c.AssertFormat = true
+		if wnmErr = c.AddResource(wnmSchemaURL, bytes.NewReader(wnmSchema)); wnmErr != nil {
+			return
+		}
+		wnmCompiled, wnmErr = c.Compile(wnmSchemaURL)
+	})
+	return wnmCompiled, wnmErr
+}
+
+// ValidationError lists the problems found validating a notification message or
+// metadata record
+type ValidationError struct {
+	// Kind is what was validated, i.e., notification or metadata
+	Kind     string
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid " + e.Kind + ": " + strings.Join(e.Problems, "; ")
+}
+
+// ValidateNotification validates an encoded notification message against the WIS2
+// Notification Message schema, and checks what the schema cannot express, i.e., that
+// the geometry is valid and the WIGOS station identifier is well formed. A
+// *ValidationError is returned if there are problems.
+func ValidateNotification(dat []byte) error {
+	schema, err := compiledWNMSchema()
+	if err != nil {
+		return fmt.Errorf("compiling wnm schema: %w", err)
+	}
+
+	var doc any
+	dec := json.NewDecoder(bytes.NewReader(dat))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		return &ValidationError{Kind: "notification", Problems: []string{fmt.Sprintf("not json: %s", err)}}
+	}
+
+	problems := []string{}
+	var verr *jsonschema.ValidationError
+	if err := schema.Validate(doc); errors.As(err, &verr) {
+		problems = append(problems, schemaProblems(verr)...)
+	} else if err != nil {
+		return err
+	}
+
+	if msg, ok := doc.(map[string]any); ok {
+		if geom, ok := msg["geometry"].(map[string]any); ok {
+			dat, _ := json.Marshal(geom)
+			g := &Geometry{}
+			if err := json.Unmarshal(dat, g); err == nil {
+				if err := g.Validate(); err != nil {
+					problems = append(problems, fmt.Sprintf("/geometry: %s", err))
+				}
+			}
+		}
+		props, _ := msg["properties"].(map[string]any)
+		if id, ok := props["wigos_station_identifier"].(string); ok {
+			if err := ValidateWigosID(id); err != nil {
+				problems = append(problems, fmt.Sprintf("/properties/wigos_station_identifier: %s", err))
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Kind: "notification", Problems: problems}
+	}
+	return nil
+}
+
+type validator struct {
+	problems []string
+	warnings []string
+}
+
+func (v *validator) add(problem string) { v.problems = append(v.problems, problem) }
+
+func (v *validator) warn(warning string) { v.warnings = append(v.warnings, warning) }
+
+func containsValue(values []any, want string) bool {
+	for _, v := range values {
+		if s, ok := v.(string); ok && s == want {
+			return true
+		}
+	}
+	return false
+}
+
+// NotificationChecks configure checks of a notification message in addition to
+// validating it against the specification
+type NotificationChecks struct {
+	// Topic, if set, is checked to be a valid WIS2 topic consistent with the message data
+	// policy and data_id
+	Topic string
+	// DataFile, if set, is a local copy of the data whose length and checksum must match
+	// the message
+	DataFile string
+	// Links checks each link is reachable and, if the link has a length, serves content
+	// of that length. Links with access control are not checked.
+	Links bool
+	// Client is used to check links. http.DefaultClient is used if nil.
+	Client *http.Client
+	// Timeout is the timeout for checking each link
+	Timeout time.Duration
+}
+
+// CheckNotification runs checks on a decoded notification message and returns the
+// problems found, and warnings for what is recommended but not required, e.g., a data_id
+// that does not include the topic centre-id.
+func CheckNotification(ctx context.Context, msg *NotificationMsgV04, checks NotificationChecks) ([]string, []string) {
+	v := &validator{}
+	if checks.Topic != "" {
+		if err := ValidateTopic(checks.Topic); err != nil {
+			v.add(err.Error())
+		} else {
+			if err := validateDataPolicy(checks.Topic, msg.Links); err != nil {
+				v.add(err.Error())
+			}
+			centre := strings.Split(checks.Topic, "/")[3]
+			if !slices.Contains(strings.Split(msg.Properties.DataID, "/"), centre) {
+				v.warn(fmt.Sprintf("data_id %q does not include the topic centre-id %s", msg.Properties.DataID, centre))
+			}
+		}
+	}
+
+	if checks.DataFile != "" {
+		v.dataFile(msg, checks.DataFile)
+	}
+
+	if checks.Links {
+		v.problems = append(v.problems, CheckLinks(ctx, checks.Client, msg.Links, checks.Timeout)...)
+	}
+	return v.problems, v.warnings
+}
+
+// CheckLinks checks each http(s) link is reachable and, if the link has a length, serves
+// content of that length, and returns the problems found. Links with access control, and
+// links with other schemes, e.g., mqtts links in metadata, are not checked.
+func CheckLinks(ctx context.Context, client *http.Client, links []Link, timeout time.Duration) []string {
+	problems := []string{}
+	for i, link := range links {
+		scheme, _, _ := strings.Cut(link.Href, "://")
+		if link.Security != nil || (scheme != "http" && scheme != "https") {
+			continue
+		}
+		length := link.Length
+		if length == 0 {
+			length = -1
+		}
+		if _, err := VerifyDownload(ctx, client, link.Href, length, nil, timeout); err != nil {
+			problems = append(problems, fmt.Sprintf("links[%d]: %s", i, err))
+		}
+	}
+	return problems
+}
+
+// dataFile checks the length and checksum of a local copy of the data match the
+// canonical link and integrity of msg.
+func (v *validator) dataFile(msg *NotificationMsgV04, fpath string) {
+	link, integrity, err := CanonicalLink(msg)
+	if err != nil {
+		v.add(err.Error())
+		return
+	}
+	if integrity == nil {
+		v.add("no integrity to check the data file against")
+		return
+	}
+	h, err := newHash(integrity.Method)
+	if err != nil {
+		v.add(err.Error())
+		return
+	}
+	f, err := os.Open(fpath)
+	if err != nil {
+		v.add(fmt.Sprintf("reading data file: %s", err))
+		return
+	}
+	defer f.Close()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		v.add(fmt.Sprintf("reading data file: %s", err))
+		return
+	}
+	if link.Length > 0 && size != link.Length {
+		v.add(fmt.Sprintf("data file length %d does not match the canonical link length %d", size, link.Length))
+	}
+	if base64.StdEncoding.EncodeToString(h.Sum(nil)) != integrity.Value {
+		v.add(fmt.Sprintf("data file %s checksum does not match the message integrity", integrity.Method))
+	}
+}
@@ -0,0 +1,141 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateNotification(t *testing.T) {
+	fpath := filepath.Join(t.TempDir(), "granule.nc")
+	require.NoError(t, os.WriteFile(fpath, []byte("xxx"), 0o644))
+	in, err := NewInput(fpath, InputConfig{})
+	require.NoError(t, err)
+	downloadURL, _ := url.Parse("https://server/granule.nc")
+	opts := NotificationOptions{
+		Topic:       "origin/a/wis2/x/data/core/weather",
+		DownloadURL: downloadURL,
+		Start:       "2024-01-02T03:04:05Z",
+		Geometry:    NewBBox(-100, 20, -80, 40),
+		WigosID:     "0-20000-0-72641",
+		NoCache:     true,
+	}
+	msg, err := NewNotificationMessage(context.Background(), in, opts)
+	require.NoError(t, err)
+	dat, err := EncodeMessage(msg, map[string]any{"extra": 1}, false)
+	require.NoError(t, err)
+	require.NoError(t, ValidateNotification(dat))
+
+	cases := []struct {
+		name     string
+		json     string
+		problems []string
+	}{
+		{"not json", `{`, []string{"not json: unexpected EOF"}},
+		{"not an object", `[]`, []string{"/: expected object, but got array"}},
+		{"empty", `{}`, []string{"/: missing properties: 'id', 'conformsTo', 'type', 'geometry', 'properties', 'links'"}},
+		{"invalid values", `{
+			"id": "abc",
+			"type": "Feature",
+			"conformsTo": ["http://wis.wmo.int/spec/wnm/1/conf/core"],
+			"geometry": {"type": "Point", "coordinates": [200, 0]},
+			"properties": {
+				"data_id": 1,
+				"pubtime": "yesterday",
+				"integrity": {"method": "md5", "value": "xxx"},
+				"cache": "no",
+				"wigos_station_identifier": "12345"
+			},
+			"links": [{"href": "https://server/granule.nc", "length": -1}]
+		}`, []string{
+			"/id: 'abc' is not valid 'uuid'",
+			"/links/0/length: must be >= 0 but found -1",
+			"/links/0: missing properties: 'rel'",
+			"/properties/cache: expected boolean, but got string",
+			"/properties/data_id: expected string, but got number",
+			`/properties/integrity/method: value must be one of "sha256", "sha384", "sha512", "sha3-256", "sha3-384", "sha3-512"`,
+			"/properties/pubtime: 'yesterday' is not valid 'date-time'",
+			"/properties: missing properties: 'datetime'",
+			"/properties: missing properties: 'start_datetime', 'end_datetime'",
+			"/geometry: longitude 200 out of range [-180, 180]",
+			`/properties/wigos_station_identifier: invalid wigos station identifier "12345", expected <series>-<issuer>-<issue number>-<local id>`,
+		}},
+		{"datetimes", `{
+			"id": "6f7a9b2e-5f0c-4c1e-9a3d-2b8e4f6a1c3d",
+			"type": "Feature",
+			"conformsTo": ["http://wis.wmo.int/spec/wnm/1/conf/core"],
+			"geometry": null,
+			"properties": {
+				"data_id": "x/granule.nc",
+				"pubtime": "2024-01-02T03:04:05Z",
+				"start_datetime": "..",
+				"end_datetime": "2024-01-02T03:04:05Z"
+			},
+			"links": [{"href": "https://server/granule.nc", "rel": "canonical"}]
+		}`, []string{"/properties/start_datetime: '..' is not valid 'date-time'"}},
+	}
+	for _, test := range cases {
+		err := ValidateNotification([]byte(test.json))
+		verr := &ValidationError{}
+		require.True(t, errors.As(err, &verr), test.name)
+		require.Equal(t, test.problems, verr.Problems, test.name)
+	}
+}
+
+func TestCheckNotification(t *testing.T) {
+	content := []byte("some served content")
+	fpath := filepath.Join(t.TempDir(), "granule.nc")
+	require.NoError(t, os.WriteFile(fpath, content, 0o644))
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/granule.nc" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(content)
+	}))
+	defer srv.Close()
+
+	msg := &NotificationMsgV04{
+		Properties: NotificationMsgV04Properties{
+			DataID:    "wis2/us-ssec/data/core/weather/granule.nc",
+			Integrity: Integrity{Method: "sha512", Value: sha512b64(content)},
+		},
+		Links: []Link{
+			{Href: srv.URL + "/granule.nc", Rel: "canonical", Length: int64(len(content))},
+			{Href: srv.URL + "/preview.png", Rel: "preview"},
+			{Href: srv.URL + "/protected", Rel: "via", Security: &Security{}},
+			{Href: "mqtts://broker", Rel: "items"},
+		},
+	}
+	ctx := context.Background()
+
+	problems, warnings := CheckNotification(ctx, msg, NotificationChecks{
+		Topic:    "origin/a/wis2/us-ssec/data/core/weather",
+		DataFile: fpath,
+	})
+	require.Equal(t, []string{"core data cannot have access control, use a data/recommended topic"}, problems)
+	require.Empty(t, warnings)
+
+	problems, warnings = CheckNotification(ctx, msg, NotificationChecks{Topic: "origin/a/wis2/us-nws/data/recommended/weather"})
+	require.Equal(t, []string{"recommended data requires a license link"}, problems)
+	require.Equal(t, []string{
+		`data_id "wis2/us-ssec/data/core/weather/granule.nc" does not include the topic centre-id us-nws`,
+	}, warnings)
+
+	require.NoError(t, os.WriteFile(fpath, []byte("other content"), 0o644))
+	problems, _ = CheckNotification(ctx, msg, NotificationChecks{DataFile: fpath, Links: true, Timeout: time.Second})
+	require.Len(t, problems, 3)
+	require.Equal(t, "data file length 13 does not match the canonical link length 19", problems[0])
+	require.Equal(t, "data file sha512 checksum does not match the message integrity", problems[1])
+	require.Contains(t, problems[2], "links[1]: ")
+	require.Contains(t, problems[2], "404")
+}
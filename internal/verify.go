@@ -0,0 +1,163 @@
+package internal
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// newHash returns a hash for a notification integrity method.
+func newHash(method string) (hash.Hash, error) {
+	switch strings.ToLower(method) {
+	case "sha256":
+		return sha256.New(), nil
+	case "sha384":
+		return sha512.New384(), nil
+	case "sha512":
+		return sha512.New(), nil
+	}
+	return nil, fmt.Errorf("unsupported integrity method: %s", method)
+}
+
+// DownloadCheck is the result of verifying a download URL serves the expected content.
+type DownloadCheck struct {
+	URL string
+	// Method is the request method used to determine reachability and length
+	Method     string
+	StatusCode int
+	// Length is the length reported by the server, or -1 if unknown
+	Length int64
+	// Integrity is the integrity of the served content, if it was checked
+	Integrity *Integrity
+	// Problems describes each check that failed
+	Problems []string
+}
+
+func (c *DownloadCheck) OK() bool { return len(c.Problems) == 0 }
+
+func (c *DownloadCheck) Error() string {
+	return fmt.Sprintf("download url %s failed verification: %s", c.URL, strings.Join(c.Problems, "; "))
+}
+
+// VerifyDownload checks that href is reachable and serves content with the expected
+// length, if length >= 0, and, if integrity is not nil, the expected integrity.
+//
+// Reachability and length are determined using a HEAD request, falling back to a ranged
+// GET for servers that do not support HEAD. If any check fails the returned error is the
+// *DownloadCheck describing the failures.
+func VerifyDownload(ctx context.Context, client *http.Client, href string, length int64, integrity *Integrity, timeout time.Duration) (*DownloadCheck, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	check := &DownloadCheck{URL: href, Method: http.MethodHead, Length: -1}
+	resp, err := request(ctx, client, http.MethodHead, href, "")
+	if err == nil && (resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode == http.StatusNotImplemented) {
+		check.Method = http.MethodGet
+		resp, err = request(ctx, client, http.MethodGet, href, "bytes=0-0")
+	}
+	if err != nil {
+		check.Problems = append(check.Problems, fmt.Sprintf("not reachable: %s", err))
+		return check, check
+	}
+	check.StatusCode = resp.StatusCode
+	check.Length = responseLength(resp)
+
+	switch {
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		check.Problems = append(check.Problems, fmt.Sprintf("unexpected status: %s", resp.Status))
+		return check, check
+	case length < 0:
+		// length not checked
+	case check.Length < 0:
+		check.Problems = append(check.Problems, "server did not report a content length")
+	case check.Length != length:
+		check.Problems = append(check.Problems, fmt.Sprintf("content length %d does not match expected %d", check.Length, length))
+	}
+
+	if integrity != nil {
+		check.Integrity, err = servedIntegrity(ctx, client, href, integrity.Method)
+		switch {
+		case err != nil:
+			check.Problems = append(check.Problems, fmt.Sprintf("checksumming served content: %s", err))
+		case check.Integrity.Value != integrity.Value:
+			check.Problems = append(check.Problems, fmt.Sprintf("%s checksum of served content does not match", integrity.Method))
+		}
+	}
+
+	if !check.OK() {
+		return check, check
+	}
+	return check, nil
+}
+
+func request(ctx context.Context, client *http.Client, method, href, byteRange string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, href, nil)
+	if err != nil {
+		return nil, err
+	}
+	if byteRange != "" {
+		req.Header.Set("Range", byteRange)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	// only the headers are used
+	resp.Body.Close()
+	return resp, nil
+}
+
+// responseLength returns the full length of the resource, taking into account ranged
+// responses.
+func responseLength(resp *http.Response) int64 {
+	if resp.StatusCode == http.StatusPartialContent {
+		// Content-Range: bytes 0-0/1234
+		_, total, ok := strings.Cut(resp.Header.Get("Content-Range"), "/")
+		if !ok {
+			return -1
+		}
+		n, err := strconv.ParseInt(total, 10, 64)
+		if err != nil {
+			return -1
+		}
+		return n
+	}
+	return resp.ContentLength
+}
+
+func servedIntegrity(ctx context.Context, client *http.Client, href, method string) (*Integrity, error) {
+	h, err := newHash(method)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, href, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	if _, err := io.Copy(h, resp.Body); err != nil {
+		return nil, err
+	}
+	return &Integrity{Method: method, Value: base64.StdEncoding.EncodeToString(h.Sum(nil))}, nil
+}
@@ -0,0 +1,82 @@
+package internal
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyDownload(t *testing.T) {
+	content := []byte("some served content")
+	integrity := &Integrity{Method: "sha512", Value: sha512b64(content)}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/file":
+			http.ServeContent(w, r, "file", time.Time{}, strings.NewReader(string(content)))
+		case "/nohead":
+			// ranged GET only
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			http.ServeContent(w, r, "file", time.Time{}, strings.NewReader(string(content)))
+		case "/slow":
+			time.Sleep(200 * time.Millisecond)
+		case "/changed":
+			http.ServeContent(w, r, "file", time.Time{}, strings.NewReader(strings.ToUpper(string(content))))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	size := int64(len(content))
+
+	t.Run("ok", func(t *testing.T) {
+		check, err := VerifyDownload(ctx, nil, srv.URL+"/file", size, integrity, time.Second)
+		require.NoError(t, err)
+		require.Equal(t, http.MethodHead, check.Method)
+		require.Equal(t, size, check.Length)
+		require.Equal(t, integrity, check.Integrity)
+	})
+
+	t.Run("ranged get fallback", func(t *testing.T) {
+		check, err := VerifyDownload(ctx, nil, srv.URL+"/nohead", size, nil, time.Second)
+		require.NoError(t, err)
+		require.Equal(t, http.MethodGet, check.Method)
+		require.Equal(t, size, check.Length)
+	})
+
+	t.Run("wrong length", func(t *testing.T) {
+		check, err := VerifyDownload(ctx, nil, srv.URL+"/file", size+1, nil, time.Second)
+		require.Error(t, err)
+		require.Len(t, check.Problems, 1)
+		require.Contains(t, err.Error(), "does not match expected")
+	})
+
+	t.Run("wrong checksum", func(t *testing.T) {
+		check, err := VerifyDownload(ctx, nil, srv.URL+"/changed", size, integrity, time.Second)
+		require.Error(t, err)
+		require.Len(t, check.Problems, 1)
+		require.Contains(t, err.Error(), "checksum")
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		_, err := VerifyDownload(ctx, nil, srv.URL+"/missing", size, nil, time.Second)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "404")
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		_, err := VerifyDownload(ctx, nil, srv.URL+"/slow", size, nil, 50*time.Millisecond)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "not reachable")
+	})
+}
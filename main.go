@@ -1,14 +1,17 @@
 package main
 
 import (
+	"log/slog"
+	"os"
+
 	"gitlab.ssec.wisc.edu/dbrtn/wispub/cmd"
-	"log"
 )
 
 var version = "<notset>"
 
 func main() {
 	if err := cmd.Execute(version); err != nil {
-		log.Fatalf("error: %v", err)
+		slog.Error(err.Error())
+		os.Exit(1)
 	}
 }